@@ -0,0 +1,67 @@
+package obpath
+
+import (
+	"strings"
+)
+
+// Feature is a path feature that a context can deny, features can be
+// combined as flags.
+type Feature int
+
+const (
+	// Descendants are descendant selectors like ..name, they also have to be
+	// enabled with AllowDescendants
+	Descendants Feature = 1 << iota
+	// Wildcards are selectors for all children or items, .* and [*]
+	Wildcards
+	// Slices are selectors for ranges of items like [1:3]
+	Slices
+	// Conditions are expressions filtering children or items like (has(@.name))
+	Conditions
+	// ValueFunctions are value function calls in condition arguments like length(@.name)
+	ValueFunctions
+	// Quantifiers are the all, any and none wrappers of conditions
+	Quantifiers
+)
+
+// FeatureNames returns the names of one or more feature flags
+func FeatureNames(features Feature) []string {
+	names := []string{}
+	if features&Descendants == Descendants {
+		names = append(names, "descendant selectors")
+	}
+	if features&Wildcards == Wildcards {
+		names = append(names, "wildcards")
+	}
+	if features&Slices == Slices {
+		names = append(names, "slices")
+	}
+	if features&Conditions == Conditions {
+		names = append(names, "conditions")
+	}
+	if features&ValueFunctions == ValueFunctions {
+		names = append(names, "value functions")
+	}
+	if features&Quantifiers == Quantifiers {
+		names = append(names, "quantifiers")
+	}
+	return names
+}
+
+// checkFeature fails with a syntax error at index if the context denies the
+// feature.
+func (c *compiler) checkFeature(context *Context, feature Feature, index int) error {
+	if context.Denied&feature == 0 {
+		return nil
+	}
+	return c.errorAt(index, "%v are not allowed", strings.Join(FeatureNames(feature), ", "))
+}
+
+// checkFunction fails with a syntax error at index if the context denies the
+// named condition or value function.
+func (c *compiler) checkFunction(context *Context, name string, index int) error {
+	if !context.DeniedFunctions[name] {
+		return nil
+	}
+	return c.errorAt(index, "%q is not allowed", name)
+}
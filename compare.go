@@ -2,11 +2,20 @@ package obpath
 
 import (
 	"fmt"
+	"math"
 	"reflect"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
 )
 
 // FloatCast converts all non complex numbers to float64s
 func FloatCast(n interface{}) (error, float64) {
+	if n == nil {
+		return fmt.Errorf("wrong kind of value: nil"), 0.0
+	}
+
 	k := reflect.TypeOf(n).Kind()
 
 	switch k {
@@ -20,3 +29,346 @@ func FloatCast(n interface{}) (error, float64) {
 
 	return fmt.Errorf("wrong kind of value: %v", k.String()), 0.0
 }
+
+// IsNull checks if a value is nil or a nil pointer, map, slice, interface,
+// channel or function
+func IsNull(n interface{}) bool {
+	if n == nil {
+		return true
+	}
+
+	v := reflect.ValueOf(n)
+	switch v.Kind() {
+	case reflect.Chan, reflect.Func, reflect.Interface, reflect.Map, reflect.Ptr, reflect.Slice:
+		return v.IsNil()
+	}
+	return false
+}
+
+// TypeName gets the name of the type of a value, using the same names as
+// TypeNames does for argument types: "null", "bool", "integer", "float",
+// "string" and "array", with maps and structs named "object". Other kinds of
+// values are named after their reflect.Kind.
+func TypeName(n interface{}) string {
+	if IsNull(n) {
+		return "null"
+	}
+
+	v := indirectValue(reflect.ValueOf(n))
+	if !v.IsValid() {
+		return "null"
+	}
+
+	switch k := v.Kind(); {
+	case k == reflect.Bool:
+		return "bool"
+	case isIntegerKind(k):
+		return "integer"
+	case k == reflect.Float32 || k == reflect.Float64:
+		return "float"
+	case k == reflect.String:
+		return "string"
+	case k == reflect.Array || k == reflect.Slice:
+		return "array"
+	case k == reflect.Map || k == reflect.Struct:
+		return "object"
+	default:
+		return k.String()
+	}
+}
+
+// Equals checks if two values are equal. Numbers of all kinds are compared by
+// value, at float32 precision if either of them is a float32, and are
+// considered equal if they differ by at most tolerance. Strings and bools are
+// compared by value regardless of their named type, and arrays, slices, maps
+// and structs are compared deeply.
+func Equals(a interface{}, b interface{}, tolerance float64) bool {
+	if IsNull(a) || IsNull(b) {
+		return IsNull(a) && IsNull(b)
+	}
+	return valuesEqual(reflect.ValueOf(a), reflect.ValueOf(b), tolerance)
+}
+
+func valuesEqual(a reflect.Value, b reflect.Value, tolerance float64) bool {
+	a = indirectValue(a)
+	b = indirectValue(b)
+
+	if !a.IsValid() || !b.IsValid() {
+		return !a.IsValid() && !b.IsValid()
+	}
+
+	if isNumberKind(a.Kind()) && isNumberKind(b.Kind()) {
+		return numbersEqual(a, b, tolerance)
+	}
+
+	if a.Kind() != b.Kind() {
+		return false
+	}
+
+	switch a.Kind() {
+	case reflect.String:
+		return a.String() == b.String()
+	case reflect.Bool:
+		return a.Bool() == b.Bool()
+	case reflect.Array, reflect.Slice:
+		if a.Len() != b.Len() {
+			return false
+		}
+		for i := 0; i < a.Len(); i++ {
+			if !valuesEqual(a.Index(i), b.Index(i), tolerance) {
+				return false
+			}
+		}
+		return true
+	case reflect.Map:
+		if a.Len() != b.Len() || !a.Type().Key().AssignableTo(b.Type().Key()) {
+			return false
+		}
+		for _, key := range a.MapKeys() {
+			// A missing key isn't the same as a null value
+			value := b.MapIndex(key)
+			if !value.IsValid() || !valuesEqual(a.MapIndex(key), value, tolerance) {
+				return false
+			}
+		}
+		return true
+	case reflect.Struct:
+		if a.Type() != b.Type() {
+			return false
+		}
+		for i := 0; i < a.NumField(); i++ {
+			if !valuesEqual(a.Field(i), b.Field(i), tolerance) {
+				return false
+			}
+		}
+		return true
+	}
+
+	if a.Type() == b.Type() && a.CanInterface() && b.CanInterface() {
+		return reflect.DeepEqual(a.Interface(), b.Interface())
+	}
+	return false
+}
+
+// indirectValue steps through interfaces and pointers, nil interfaces and
+// pointers result in an invalid value
+func indirectValue(v reflect.Value) reflect.Value {
+	for v.IsValid() && (v.Kind() == reflect.Interface || v.Kind() == reflect.Ptr) {
+		if v.IsNil() {
+			return reflect.Value{}
+		}
+		v = v.Elem()
+	}
+	return v
+}
+
+func numbersEqual(a reflect.Value, b reflect.Value, tolerance float64) bool {
+	if tolerance == 0 && isIntegerKind(a.Kind()) && isIntegerKind(b.Kind()) {
+		return integersEqual(a, b)
+	}
+
+	fa := floatValue(a)
+	fb := floatValue(b)
+	if a.Kind() == reflect.Float32 || b.Kind() == reflect.Float32 {
+		fa = float64(float32(fa))
+		fb = float64(float32(fb))
+	}
+
+	return math.Abs(fa-fb) <= tolerance
+}
+
+func integersEqual(a reflect.Value, b reflect.Value) bool {
+	aSigned := isSignedKind(a.Kind())
+	bSigned := isSignedKind(b.Kind())
+
+	switch {
+	case aSigned && bSigned:
+		return a.Int() == b.Int()
+	case !aSigned && !bSigned:
+		return a.Uint() == b.Uint()
+	case aSigned:
+		return a.Int() >= 0 && uint64(a.Int()) == b.Uint()
+	default:
+		return b.Int() >= 0 && uint64(b.Int()) == a.Uint()
+	}
+}
+
+func floatValue(v reflect.Value) float64 {
+	switch {
+	case isSignedKind(v.Kind()):
+		return float64(v.Int())
+	case isIntegerKind(v.Kind()):
+		return float64(v.Uint())
+	}
+	return v.Float()
+}
+
+func isNumberKind(k reflect.Kind) bool {
+	return isIntegerKind(k) || k == reflect.Float32 || k == reflect.Float64
+}
+
+func isIntegerKind(k reflect.Kind) bool {
+	switch k {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return true
+	}
+	return false
+}
+
+func isSignedKind(k reflect.Kind) bool {
+	switch k {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return true
+	}
+	return false
+}
+
+// Compare orders a in relation to b, returning -1 if a is less than b, 0 if
+// they're equal and 1 if a is greater than b. Numbers are ordered by value,
+// time.Time values chronologically and strings lexically. RFC 3339 strings
+// are ordered chronologically when compared to a time.Time or to another
+// RFC 3339 string. An error is returned if the values can't be ordered.
+func Compare(a interface{}, b interface{}) (int, error) {
+	aTime, aIsTime := timeValue(a)
+	bTime, bIsTime := timeValue(b)
+	aString, aIsString := stringValue(a)
+	bString, bIsString := stringValue(b)
+
+	switch {
+	case aIsTime && bIsTime:
+		return compareTimes(aTime, bTime), nil
+	case aIsTime && bIsString:
+		parsed, error := time.Parse(time.RFC3339, bString)
+		if error != nil {
+			return 0, error
+		}
+		return compareTimes(aTime, parsed), nil
+	case aIsString && bIsTime:
+		parsed, error := time.Parse(time.RFC3339, aString)
+		if error != nil {
+			return 0, error
+		}
+		return compareTimes(parsed, bTime), nil
+	case aIsString && bIsString:
+		aParsed, aError := time.Parse(time.RFC3339, aString)
+		bParsed, bError := time.Parse(time.RFC3339, bString)
+		if aError == nil && bError == nil {
+			return compareTimes(aParsed, bParsed), nil
+		}
+		return strings.Compare(aString, bString), nil
+	}
+
+	error, fa := FloatCast(a)
+	if error != nil {
+		return 0, error
+	}
+	error, fb := FloatCast(b)
+	if error != nil {
+		return 0, error
+	}
+
+	switch {
+	case fa < fb:
+		return -1, nil
+	case fa > fb:
+		return 1, nil
+	}
+	return 0, nil
+}
+
+func compareTimes(a time.Time, b time.Time) int {
+	switch {
+	case a.Before(b):
+		return -1
+	case a.After(b):
+		return 1
+	}
+	return 0
+}
+
+func timeValue(n interface{}) (time.Time, bool) {
+	switch t := n.(type) {
+	case time.Time:
+		return t, true
+	case *time.Time:
+		if t != nil {
+			return *t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+func stringValue(n interface{}) (string, bool) {
+	if n == nil {
+		return "", false
+	}
+
+	v := reflect.ValueOf(n)
+	if v.Kind() == reflect.String {
+		return v.String(), true
+	}
+	return "", false
+}
+
+// FoldString case folds a string so that two strings that are equal under
+// Unicode simple case folding, see strings.EqualFold, fold to the same string.
+func FoldString(s string) string {
+	return strings.Map(foldRune, s)
+}
+
+// foldRune maps a rune to the smallest rune in its case folding orbit
+func foldRune(r rune) rune {
+	folded := r
+	for f := unicode.SimpleFold(r); f != r; f = unicode.SimpleFold(f) {
+		if f < folded {
+			folded = f
+		}
+	}
+	return folded
+}
+
+// sortValues sorts map keys by kind and then by value, so that keys of mixed
+// kinds have a total order: booleans, numbers, strings and then anything else
+// by its formatted value.
+func sortValues(values []reflect.Value) {
+	sort.SliceStable(values, func(i, j int) bool {
+		a, b := indirectValue(values[i]), indirectValue(values[j])
+		rankA, rankB := keyRank(a), keyRank(b)
+		if rankA != rankB {
+			return rankA < rankB
+		}
+
+		switch rankA {
+		case 1:
+			return !a.Bool() && b.Bool()
+		case 2:
+			// NaN goes before all other numbers
+			x, y := floatValue(a), floatValue(b)
+			if math.IsNaN(x) || math.IsNaN(y) {
+				return math.IsNaN(x) && !math.IsNaN(y)
+			}
+			return x < y
+		case 3:
+			return a.String() < b.String()
+		case 4:
+			return fmt.Sprint(a.Interface()) < fmt.Sprint(b.Interface())
+		}
+		return false
+	})
+}
+
+// keyRank orders the kinds of map keys, null goes first
+func keyRank(v reflect.Value) int {
+	switch {
+	case !v.IsValid():
+		return 0
+	case v.Kind() == reflect.Bool:
+		return 1
+	case isNumberKind(v.Kind()):
+		return 2
+	case v.Kind() == reflect.String:
+		return 3
+	}
+	return 4
+}
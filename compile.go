@@ -39,6 +39,8 @@ type pathStep struct {
 	start     int
 	end       int
 	condition *expression
+	// source is the step as written in the path expression
+	source string
 }
 
 // MustCompile returns the compiled path, and panics if
@@ -51,12 +53,19 @@ func MustCompile(path string, context *Context) *Path {
 	return compiled
 }
 
-// Compile returns the compiled path.
+// Compile returns the compiled path. A nil context is the same as
+// NewContext().
 func Compile(path string, context *Context) (*Path, error) {
-	c := compiler{path, 0}
+	if context == nil {
+		context = NewContext()
+	}
+	c := compiler{path: path, limits: context.Limits}
 	if path == "" {
 		return nil, c.errorf("empty path")
 	}
+	if exceeded(len(path), context.Limits.MaxPathLength) {
+		return nil, &LimitError{"MaxPathLength", context.Limits.MaxPathLength}
+	}
 	p, err := c.parsePath(context)
 	if err != nil {
 		return nil, err
@@ -67,10 +76,29 @@ func Compile(path string, context *Context) (*Path, error) {
 type compiler struct {
 	path  string
 	index int
+	// nesting is the current nesting of argument lists and array literals
+	nesting int
+	limits  Limits
+}
+
+// nest enters an argument list or array literal, checking the nesting limit
+func (c *compiler) nest() error {
+	c.nesting++
+	if exceeded(c.nesting, c.limits.MaxNesting) {
+		return &LimitError{"MaxNesting", c.limits.MaxNesting}
+	}
+	return nil
 }
 
 func (c *compiler) errorf(format string, args ...interface{}) error {
-	return fmt.Errorf("syntax error in path %q at character %d: %s", c.path, c.index, fmt.Sprintf(format, args...))
+	return c.errorAt(c.index, format, args...)
+}
+
+func (c *compiler) errorAt(index int, format string, args ...interface{}) error {
+	return &SyntaxError{
+		message: fmt.Sprintf("syntax error in path %q at character %d: %s", c.path, index, fmt.Sprintf(format, args...)),
+		Index:   index,
+	}
 }
 
 func (c *compiler) parsePath(context *Context) (path *Path, err error) {
@@ -79,12 +107,16 @@ func (c *compiler) parsePath(context *Context) (path *Path, err error) {
 
 	for {
 		step := pathStep{}
+		stepStart := c.index
 
 		if c.skip('.') {
 			if c.skip('.') {
 				if !context.AllowDescendants {
 					return nil, c.errorf("unexpected %q expected a name", c.offsetChar(-1))
 				}
+				if featureError := c.checkFeature(context, Descendants, stepStart); featureError != nil {
+					return nil, featureError
+				}
 				step.target = "descendant"
 			} else {
 				step.target = "child"
@@ -96,6 +128,12 @@ func (c *compiler) parsePath(context *Context) (path *Path, err error) {
 			}
 			step.name = c.path[mark:c.index]
 
+			if step.name == "*" {
+				if featureError := c.checkFeature(context, Wildcards, mark); featureError != nil {
+					return nil, featureError
+				}
+			}
+
 			// Check if we're filtering children by expressions
 			predError := c.parseExpressions(&step, context)
 			if predError != nil {
@@ -107,6 +145,9 @@ func (c *compiler) parsePath(context *Context) (path *Path, err error) {
 			mark := c.index
 
 			if c.skip('*') {
+				if featureError := c.checkFeature(context, Wildcards, mark); featureError != nil {
+					return nil, featureError
+				}
 				step.start = 0
 				step.end = -1
 			} else if c.skipInteger() {
@@ -114,6 +155,11 @@ func (c *compiler) parsePath(context *Context) (path *Path, err error) {
 
 				step.start = int(index)
 
+				if c.peek(':') {
+					if featureError := c.checkFeature(context, Slices, mark); featureError != nil {
+						return nil, featureError
+					}
+				}
 				if c.skip(':') {
 					mark = c.index
 					if c.skipInteger() {
@@ -125,7 +171,11 @@ func (c *compiler) parsePath(context *Context) (path *Path, err error) {
 				} else {
 					step.end = step.start
 				}
-			} else if c.skip(':') {
+			} else if c.peek(':') {
+				if featureError := c.checkFeature(context, Slices, mark); featureError != nil {
+					return nil, featureError
+				}
+				c.skip(':')
 				step.start = 0
 				mark = c.index
 				if c.skipInteger() {
@@ -154,6 +204,7 @@ func (c *compiler) parsePath(context *Context) (path *Path, err error) {
 			}, nil
 		}
 
+		step.source = c.path[stepStart:c.index]
 		steps = append(steps, step)
 	}
 }
@@ -161,9 +212,13 @@ func (c *compiler) parsePath(context *Context) (path *Path, err error) {
 func (c *compiler) parseExpressions(step *pathStep, context *Context) error {
 	// The initial ( tells us that we're using filters, it's fine if it's missing
 	// that just means that we don't have any expressions.
-	if !c.skip('(') {
+	if !c.peek('(') {
 		return nil
 	}
+	if featureError := c.checkFeature(context, Conditions, c.index); featureError != nil {
+		return featureError
+	}
+	c.skip('(')
 
 	c.skipAll(' ')
 
@@ -175,6 +230,25 @@ func (c *compiler) parseExpressions(step *pathStep, context *Context) error {
 		return c.errorf("unexpected %v, expected expression name", c.currentChar())
 	}
 	name := c.path[mark:c.index]
+
+	// A quantifier wraps the condition in another set of parenthesis
+	quantifier, quantified := quantifiers[name]
+	if quantified {
+		if featureError := c.checkFeature(context, Quantifiers, mark); featureError != nil {
+			return featureError
+		}
+		if !c.skip('(') {
+			return c.expectedCharError('(')
+		}
+		c.skipAll(' ')
+
+		mark = c.index
+		if !c.skipName() {
+			return c.errorf("unexpected %v, expected expression name", c.currentChar())
+		}
+		name = c.path[mark:c.index]
+	}
+
 	function := context.ConditionFunctions[name]
 
 	if function == nil {
@@ -182,100 +256,240 @@ func (c *compiler) parseExpressions(step *pathStep, context *Context) error {
 			name,
 			strings.Join(context.ConditionNames(), ", "))
 	}
+	if functionError := c.checkFunction(context, name, mark); functionError != nil {
+		return functionError
+	}
 
-	argCount := len(function.Arguments)
+	arguments, argError := c.parseArguments(function.signature(), context)
+	if argError != nil {
+		return argError
+	}
+	if function.check != nil {
+		if checkError := function.check(arguments); checkError != nil {
+			return c.errorf("%v: %v", name, checkError)
+		}
+	}
+
+	if quantified {
+		if len(arguments) == 0 || arguments[0].Type != PathArg {
+			return c.errorf("quantified expression %q must have a path as its first argument", name)
+		}
+
+		c.skipAll(' ')
+		// Parenthesis ending the quantifier
+		if !c.skip(')') {
+			return c.expectedCharError(')')
+		}
+	}
 
 	step.condition = &expression{
-		Condition: function,
-		Inverse:   inverse,
-		Arguments: make([]ExpressionArgument, argCount),
+		Condition:  function,
+		Inverse:    inverse,
+		Quantifier: quantifier,
+		Arguments:  arguments,
 	}
 
-	// Parenthesis leading in to the argument list
-	if !c.skip('(') {
-		return c.expectedCharError('(')
+	c.skipAll(' ')
+	// Parenthesis ending the expression
+	if !c.skip(')') {
+		return c.expectedCharError(')')
 	}
 
-	// Read arguments
-	argIndex := 0
-	for {
-		c.skipAll(' ')
-		mark = c.index
+	return nil
+}
 
-		if argIndex >= argCount {
-			return c.errorf("unexpected argument %v, only expected %v arguments", argIndex+1, argCount)
-		}
+// parseArguments parses a parenthesised argument list, checking the arguments
+// against the signature and filling in defaults for left out optional
+// arguments.
+func (c *compiler) parseArguments(sig signature, context *Context) ([]ExpressionArgument, error) {
+	arguments := []ExpressionArgument{}
 
-		argument := ExpressionArgument{}
+	defer func() { c.nesting-- }()
+	if limitError := c.nest(); limitError != nil {
+		return nil, limitError
+	}
 
-		// A path reference
-		if c.skip('@') {
-			refCompiler := compiler{path: c.path, index: c.index}
-			refPath, refError := refCompiler.parsePath(context)
+	// Parenthesis leading in to the argument list
+	if !c.skip('(') {
+		return nil, c.expectedCharError('(')
+	}
 
-			if refError != nil {
-				return refError
-			}
+	c.skipAll(' ')
+	empty := sig.required() == 0 && c.peek(')')
 
-			argument.Type = PathArg
-			argument.Value = refPath
-			c.index = refCompiler.index
-		} else if c.peek('"') || c.peek('\'') { // A string literal
+	// Read arguments
+	for !empty {
+		c.skipAll(' ')
 
-			stringArg, litError := c.parseStringLiteral()
+		argType, accepted := sig.argumentType(len(arguments))
+		if !accepted {
+			return nil, c.errorf("unexpected argument %v, expected %v", len(arguments)+1, sig.describe())
+		}
 
-			if litError != nil {
-				return c.errorf("failed to parse string literal: %v", litError.Error())
-			}
+		argument, argError := c.parseArgument(argType, context)
+		if argError != nil {
+			return nil, argError
+		}
 
-			argument.Type = StringArg
-			argument.Value = stringArg
-		} else if isNumber, isFloat := c.skipNumber(); isNumber { // An integer or float
-			if !isFloat && function.Arguments[argIndex]&IntegerArg > 0 {
-				value, _ := strconv.ParseInt(c.path[mark:c.index], 10, 64)
-				argument.Type = IntegerArg
-				argument.Value = value
-			} else {
-				value, _ := strconv.ParseFloat(c.path[mark:c.index], 64)
-				argument.Type = FloatArg
-				argument.Value = value
-			}
+		if argument.Type == 0 {
+			return nil, c.errorf("unexpected %v, expected an argument", c.currentChar())
 		}
 
-		if argument.Type != 0 {
-			if argument.Type&function.Arguments[argIndex] == 0 {
-				return c.errorf("unexpected argument type %v, expected one of: %v",
-					TypeNames(argument.Type)[0],
-					strings.Join(TypeNames(function.Arguments[argIndex]), ", "))
-			}
+		if argument.Type&argType == 0 {
+			return nil, c.errorf("unexpected argument type %v, expected one of: %v",
+				TypeNames(argument.Type)[0],
+				strings.Join(TypeNames(argType), ", "))
 		}
 
-		step.condition.Arguments[argIndex] = argument
+		arguments = append(arguments, argument)
 
 		// If the next character isn't a comma we don't have any more arguments
+		c.skipAll(' ')
 		if !c.skip(',') {
 			break
 		}
-		argIndex++
 	}
 
-	if argIndex+1 != argCount {
-		return c.errorf("expected %v arguments, only got %v", argCount, argIndex+1)
+	if len(arguments) < sig.required() {
+		return nil, c.errorf("expected %v, only got %v", sig.describe(), len(arguments))
 	}
 
 	c.skipAll(' ')
 	// Parenthesis ending the argument list
 	if !c.skip(')') {
-		return c.expectedCharError(')')
+		return nil, c.expectedCharError(')')
 	}
 
-	c.skipAll(' ')
-	// Parenthesis ending the expression
-	if !c.skip(')') {
-		return c.expectedCharError(')')
+	return sig.withDefaults(arguments), nil
+}
+
+// parseArgument parses a single argument: a path reference, a value function
+// call or a literal, including array literals.
+func (c *compiler) parseArgument(argType int, context *Context) (ExpressionArgument, error) {
+	argument := ExpressionArgument{}
+	mark := c.index
+
+	if c.skip('@') { // A path reference
+		refPath := &Path{context: context}
+
+		// A lone @ references the current item
+		if c.peek('.') || c.peek('[') {
+			refCompiler := compiler{path: c.path, index: c.index, nesting: c.nesting, limits: c.limits}
+			var refError error
+			refPath, refError = refCompiler.parsePath(context)
+
+			if refError != nil {
+				return argument, refError
+			}
+			c.index = refCompiler.index
+		}
+
+		argument.Type = PathArg
+		argument.Value = refPath
+	} else if c.peek('"') || c.peek('\'') { // A string literal
+
+		stringArg, litError := c.parseStringLiteral()
+
+		if litError != nil {
+			return argument, c.errorf("failed to parse string literal: %v", litError.Error())
+		}
+
+		argument.Type = StringArg
+		argument.Value = stringArg
+	} else if c.skip('[') { // An array literal
+		values := []interface{}{}
+
+		defer func() { c.nesting-- }()
+		if limitError := c.nest(); limitError != nil {
+			return argument, limitError
+		}
+
+		c.skipAll(' ')
+		if !c.peek(']') {
+			for {
+				c.skipAll(' ')
+
+				item, itemError := c.parseArgument(LiteralArg, context)
+				if itemError != nil {
+					return argument, itemError
+				}
+				if item.Type == 0 {
+					return argument, c.errorf("unexpected %v, expected an array item", c.currentChar())
+				}
+				if item.Type&LiteralArg == 0 {
+					return argument, c.errorf("unexpected array item type %v, expected one of: %v",
+						TypeNames(item.Type)[0],
+						strings.Join(TypeNames(LiteralArg), ", "))
+				}
+				values = append(values, item.Value)
+
+				c.skipAll(' ')
+				if !c.skip(',') {
+					break
+				}
+			}
+		}
+
+		if !c.skip(']') {
+			return argument, c.expectedCharError(']')
+		}
+
+		argument.Type = ArrayArg
+		argument.Value = values
+	} else if isNumber, isFloat := c.skipNumber(); isNumber { // An integer or float
+		if !isFloat && argType&IntegerArg > 0 {
+			value, _ := strconv.ParseInt(c.path[mark:c.index], 10, 64)
+			argument.Type = IntegerArg
+			argument.Value = value
+		} else {
+			value, _ := strconv.ParseFloat(c.path[mark:c.index], 64)
+			argument.Type = FloatArg
+			argument.Value = value
+		}
+	} else if c.skipName() { // A value function call or a keyword literal
+		name := c.path[mark:c.index]
+
+		if !c.peek('(') {
+			switch name {
+			case "true", "false":
+				argument.Type = BoolArg
+				argument.Value = name == "true"
+				return argument, nil
+			case "null":
+				argument.Type = NullArg
+				argument.Value = nil
+				return argument, nil
+			}
+		}
+
+		function := context.ValueFunctions[name]
+
+		if function == nil {
+			return argument, c.errorf("Unknown value function %q, expected one of: %v",
+				name,
+				strings.Join(context.ValueNames(), ", "))
+		}
+		if featureError := c.checkFeature(context, ValueFunctions, mark); featureError != nil {
+			return argument, featureError
+		}
+		if functionError := c.checkFunction(context, name, mark); functionError != nil {
+			return argument, functionError
+		}
+
+		arguments, argError := c.parseArguments(function.signature(), context)
+		if argError != nil {
+			return argument, argError
+		}
+
+		// Value functions produce a list of values, just like path references.
+		argument.Type = PathArg
+		argument.Value = &valueCall{
+			Function:  function,
+			Arguments: arguments,
+		}
 	}
 
-	return nil
+	return argument, nil
 }
 
 func (c *compiler) unexpectedCharError() error {
@@ -351,7 +565,7 @@ func (c *compiler) skipAll(b byte) bool {
 func (c *compiler) skipInteger() bool {
 	start := c.index
 
-	if c.path[c.index] == '-' || c.path[c.index] == '+' {
+	if c.peek('-') || c.peek('+') {
 		c.index++
 	}
 
@@ -1,12 +1,15 @@
 package obpath
 
 import (
+	"fmt"
+	"path"
 	"reflect"
 	"strings"
 )
 
 const (
-	// PathArg arguments references items relative to the current item represented as an array of interface{}
+	// PathArg arguments references items relative to the current item represented as an array of interface{},
+	// value function calls are passed as PathArg arguments as well
 	PathArg = 1 << iota
 	// FloatArg arguments are number literals with an optional fractional part represented as a 64 bit floats
 	FloatArg = 1 << iota
@@ -14,8 +17,14 @@ const (
 	IntegerArg = 1 << iota
 	// StringArg are strings literals bounded by ", ' or ` represented as strings, no escape sequences are recognised
 	StringArg = 1 << iota
+	// BoolArg arguments are the literals true and false represented as bools
+	BoolArg = 1 << iota
+	// NullArg arguments are the literal null represented as nil
+	NullArg = 1 << iota
+	// ArrayArg arguments are lists of literals bounded by [ and ] represented as an array of interface{}
+	ArrayArg = 1 << iota
 	// LiteralArg can be any of the literal arguments
-	LiteralArg = StringArg | FloatArg | StringArg
+	LiteralArg = StringArg | FloatArg | IntegerArg | BoolArg | NullArg | ArrayArg
 )
 
 // TypeNames returns the names of one or more type flags
@@ -33,22 +42,189 @@ func TypeNames(argType int) []string {
 	if argType&StringArg == StringArg {
 		names = append(names, "string")
 	}
+	if argType&BoolArg == BoolArg {
+		names = append(names, "bool")
+	}
+	if argType&NullArg == NullArg {
+		names = append(names, "null")
+	}
+	if argType&ArrayArg == ArrayArg {
+		names = append(names, "array")
+	}
 	return names
 }
 
 // ConditionFunction is a function that can be used to filter matches.
 type ConditionFunction struct {
 	// TestFunction is the function that will be run to determine the truthiness of the expression.
+	// Path arguments can match several values, and by convention a condition is true if it
+	// holds for any of them. The all and none quantifiers call TestFunction once for every
+	// value of the first argument.
 	TestFunction func(arguments []ExpressionArgument) bool
+	// TestFunctionWithError is used instead of TestFunction when set, and can
+	// report an error instead of a result.
+	TestFunctionWithError func(arguments []ExpressionArgument) (bool, error)
 	// Arguments are the accepted argument types
 	Arguments []int
+	// Defaults are the values of optional trailing arguments, the last default
+	// belongs to the last argument that isn't variadic
+	Defaults []ExpressionArgument
+	// Variadic allows the last argument type to be repeated any number of times
+	Variadic bool
+	// firstValue is set for conditions that only need the first value of
+	// their path argument
+	firstValue bool
+	// check validates the literal arguments when the path is compiled
+	check func(arguments []ExpressionArgument) error
+	// contextTest is used by built in conditions that depend on the settings
+	// of the context the path was compiled with
+	contextTest func(context *Context, arguments []ExpressionArgument) (bool, error)
+}
+
+// call runs the test function, a panic in the test function is returned as
+// an error.
+func (function *ConditionFunction) call(context *Context, arguments []ExpressionArgument) (match bool, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("condition panicked: %v", r)
+		}
+	}()
+
+	if function.contextTest != nil {
+		return function.contextTest(context, arguments)
+	}
+	if function.TestFunctionWithError != nil {
+		return function.TestFunctionWithError(arguments)
+	}
+	return function.TestFunction(arguments), nil
+}
+
+func (function *ConditionFunction) signature() signature {
+	return signature{function.Arguments, function.Defaults, function.Variadic}
+}
+
+// signature describes the arguments a condition or value function accepts
+type signature struct {
+	types    []int
+	defaults []ExpressionArgument
+	variadic bool
+}
+
+// fixed is the number of arguments that aren't variadic
+func (sig signature) fixed() int {
+	if sig.variadic {
+		return len(sig.types) - 1
+	}
+	return len(sig.types)
+}
+
+// required is the number of arguments that must be given
+func (sig signature) required() int {
+	return sig.fixed() - len(sig.defaults)
+}
+
+// argumentType gets the accepted types of the argument at index, and
+// whether an argument is accepted at that index at all.
+func (sig signature) argumentType(index int) (int, bool) {
+	if index < sig.fixed() {
+		return sig.types[index], true
+	}
+	if sig.variadic {
+		return sig.types[len(sig.types)-1], true
+	}
+	return 0, false
+}
+
+// withDefaults fills in the defaults of the optional arguments left out.
+func (sig signature) withDefaults(arguments []ExpressionArgument) []ExpressionArgument {
+	for index := len(arguments); index < sig.fixed(); index++ {
+		arguments = append(arguments, sig.defaults[index-sig.required()])
+	}
+	return arguments
+}
+
+// describe describes the number of accepted arguments
+func (sig signature) describe() string {
+	switch {
+	case sig.variadic:
+		return fmt.Sprintf("at least %v", pluralArguments(sig.required()))
+	case sig.required() != sig.fixed():
+		return fmt.Sprintf("%v to %v", sig.required(), pluralArguments(sig.fixed()))
+	}
+	return pluralArguments(sig.fixed())
+}
+
+func pluralArguments(count int) string {
+	if count == 1 {
+		return "1 argument"
+	}
+	return fmt.Sprintf("%v arguments", count)
+}
+
+type quantifier int
+
+const (
+	anyQuantifier quantifier = iota
+	allQuantifier
+	noneQuantifier
+)
+
+// quantifiers are the reserved names of the quantifiers that can wrap a condition
+var quantifiers = map[string]quantifier{
+	"any":  anyQuantifier,
+	"all":  allQuantifier,
+	"none": noneQuantifier,
 }
 
 // Expression is a condition on a path segment
 type expression struct {
-	Condition *ConditionFunction
-	Inverse   bool
-	Arguments []ExpressionArgument
+	Condition  *ConditionFunction
+	Inverse    bool
+	Quantifier quantifier
+	Arguments  []ExpressionArgument
+}
+
+// test runs the condition against resolved arguments, applying the quantifier
+// to the values of the first argument.
+func (expression *expression) test(context *Context, arguments []ExpressionArgument) (bool, error) {
+	if expression.Quantifier == anyQuantifier {
+		return expression.Condition.call(context, arguments)
+	}
+
+	matches := arguments[0].Value.([]interface{})
+	single := make([]ExpressionArgument, len(arguments))
+	copy(single, arguments)
+
+	for _, match := range matches {
+		single[0].Value = []interface{}{match}
+		match, error := expression.Condition.call(context, single)
+		if error != nil {
+			return false, error
+		}
+		if match != (expression.Quantifier == allQuantifier) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// firstValueOnly checks if the condition can be tested with only the first
+// value of its path argument
+func (expression *expression) firstValueOnly() bool {
+	return expression.Condition.firstValue && expression.Quantifier == anyQuantifier
+}
+
+// describeFailure describes why an item didn't pass the expression
+func (expression *expression) describeFailure() string {
+	switch {
+	case expression.Inverse:
+		return "inverted condition was true"
+	case expression.Quantifier == allQuantifier:
+		return "condition was false for some value"
+	case expression.Quantifier == noneQuantifier:
+		return "condition was true for some value"
+	}
+	return "condition was false"
 }
 
 // ExpressionArgument is an argument that gets passed to a ConditionFunction
@@ -63,7 +239,40 @@ type ExpressionArgument struct {
 type Context struct {
 	// ConditionFuncs are the
 	ConditionFunctions map[string]*ConditionFunction
-	AllowDescendants   bool
+	// ValueFunctions are the functions that can be used to compute arguments
+	ValueFunctions   map[string]*ValueFunction
+	AllowDescendants bool
+	// FloatTolerance is the largest difference between two numbers that eq and
+	// ne still consider equal
+	FloatTolerance float64
+	// Strict makes missing keys and fields, out of range indexes and values of
+	// the wrong type evaluation errors instead of non-matches. Paths in
+	// condition arguments are never evaluated strictly, so that conditions
+	// like has still work.
+	Strict bool
+	// Limits restricts the resources used to compile and evaluate paths
+	Limits Limits
+	// ReportCycles makes descendant selectors reaching a map, slice or pointer
+	// that leads to itself an evaluation error, they're skipped otherwise
+	ReportCycles bool
+	// SortKeys makes wildcard and descendant selectors go through map keys in
+	// sorted order, rather than Go's random order, so that results are
+	// reproducible. Struct fields are always in declaration order.
+	SortKeys bool
+	// DecodeBytes makes steps into []byte values decode them as JSON, like
+	// they do with json.RawMessage values
+	DecodeBytes bool
+	// Concurrency is the number of items evaluated in parallel by steps like
+	// [*], which is worth it for large arrays and expensive conditions. The
+	// matches are in the same order as when evaluating items one by one.
+	// Conditions and value functions must be safe to call from several
+	// goroutines when it's more than 1.
+	Concurrency int
+	// Denied are the features that paths compiled with the context can't use
+	Denied Feature
+	// DeniedFunctions are the names of the conditions and value functions that
+	// paths compiled with the context can't use
+	DeniedFunctions map[string]bool
 }
 
 // ConditionNames gets the names of the available conditions
@@ -79,10 +288,77 @@ func (context *Context) ConditionNames() []string {
 	return names
 }
 
-func testEquals(arguments []ExpressionArgument) bool {
+// ValueNames gets the names of the available value functions
+func (context *Context) ValueNames() []string {
+	names := make([]string, len(context.ValueFunctions))
+
+	index := 0
+	for name := range context.ValueFunctions {
+		names[index] = name
+		index++
+	}
+
+	return names
+}
+
+func (context *Context) testEquals(arguments []ExpressionArgument) (bool, error) {
+	matches := arguments[0].Value.([]interface{})
+	for _, match := range matches {
+		if Equals(match, arguments[1].Value, context.FloatTolerance) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (context *Context) testNotEquals(arguments []ExpressionArgument) (bool, error) {
 	matches := arguments[0].Value.([]interface{})
 	for _, match := range matches {
-		if match == arguments[1].Value {
+		if !Equals(match, arguments[1].Value, context.FloatTolerance) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (context *Context) testIn(arguments []ExpressionArgument) (bool, error) {
+	matches := arguments[0].Value.([]interface{})
+	for _, match := range matches {
+		if context.inList(match, arguments[1].Value.([]interface{})) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (context *Context) testNotIn(arguments []ExpressionArgument) (bool, error) {
+	matches := arguments[0].Value.([]interface{})
+	for _, match := range matches {
+		if !context.inList(match, arguments[1].Value.([]interface{})) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (context *Context) testOneOf(arguments []ExpressionArgument) (bool, error) {
+	list := make([]interface{}, len(arguments)-1)
+	for i, argument := range arguments[1:] {
+		list[i] = argument.Value
+	}
+
+	matches := arguments[0].Value.([]interface{})
+	for _, match := range matches {
+		if context.inList(match, list) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (context *Context) inList(match interface{}, list []interface{}) bool {
+	for _, item := range list {
+		if Equals(match, item, context.FloatTolerance) {
 			return true
 		}
 	}
@@ -103,16 +379,51 @@ func testContains(arguments []ExpressionArgument) bool {
 
 func testCiContains(arguments []ExpressionArgument) bool {
 	matches := arguments[0].Value.([]interface{})
-	substring := strings.ToLower(arguments[1].Value.(string))
+	substring := FoldString(arguments[1].Value.(string))
 
 	for _, match := range matches {
-		if strings.Contains(strings.ToLower(reflect.ValueOf(match).String()), substring) {
+		if strings.Contains(FoldString(reflect.ValueOf(match).String()), substring) {
 			return true
 		}
 	}
 	return false
 }
 
+// stringTest creates a condition that checks if test holds for any of the
+// matches that are strings and the string argument. Case insensitive
+// conditions get both strings case folded before they are tested.
+func stringTest(caseInsensitive bool, test func(s string, argument string) bool) func(arguments []ExpressionArgument) bool {
+	return func(arguments []ExpressionArgument) bool {
+		matches := arguments[0].Value.([]interface{})
+		argument := arguments[1].Value.(string)
+		if caseInsensitive {
+			argument = FoldString(argument)
+		}
+
+		for _, match := range matches {
+			s, isString := stringValue(match)
+			if !isString {
+				continue
+			}
+			if caseInsensitive {
+				s = FoldString(s)
+			}
+
+			if test(s, argument) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// globMatch matches a string against a glob pattern, see path.Match. Bad
+// patterns never match.
+func globMatch(s string, pattern string) bool {
+	matched, _ := path.Match(pattern, s)
+	return matched
+}
+
 func testHas(arguments []ExpressionArgument) bool {
 	matches := arguments[0].Value.([]interface{})
 	return len(matches) > 0
@@ -126,6 +437,9 @@ func testEmpty(arguments []ExpressionArgument) bool {
 
 	allEmpty := true
 	for _, match := range matches {
+		if match == nil {
+			continue
+		}
 		if match != reflect.Zero(reflect.TypeOf(match)).Interface() {
 			allEmpty = false
 			break
@@ -135,95 +449,129 @@ func testEmpty(arguments []ExpressionArgument) bool {
 	return allEmpty
 }
 
-func testGreater(arguments []ExpressionArgument) bool {
-	matches := arguments[0].Value.([]interface{})
-
-	_, f1 := FloatCast(arguments[1].Value)
-
-	for _, match := range matches {
-		error, f0 := FloatCast(match)
-		if error != nil {
-			continue
-		}
-
-		if f0 > f1 {
-			return true
+// typeTest creates a condition that checks if any of the matches has one of
+// the named types, see TypeName.
+func typeTest(typeNames ...string) func(arguments []ExpressionArgument) bool {
+	return func(arguments []ExpressionArgument) bool {
+		matches := arguments[0].Value.([]interface{})
+		for _, match := range matches {
+			name := TypeName(match)
+			for _, typeName := range typeNames {
+				if name == typeName {
+					return true
+				}
+			}
 		}
+		return false
 	}
-	return false
 }
 
-func testLess(arguments []ExpressionArgument) bool {
-	matches := arguments[0].Value.([]interface{})
+func (context *Context) testGreater(arguments []ExpressionArgument) (bool, error) {
+	return context.anyOrdered(arguments[0].Value.([]interface{}), arguments[1].Value, func(order int) bool {
+		return order > 0
+	})
+}
 
-	_, f1 := FloatCast(arguments[1].Value)
+func (context *Context) testLess(arguments []ExpressionArgument) (bool, error) {
+	return context.anyOrdered(arguments[0].Value.([]interface{}), arguments[1].Value, func(order int) bool {
+		return order < 0
+	})
+}
 
-	for _, match := range matches {
-		error, f0 := FloatCast(match)
-		if error != nil {
-			continue
-		}
+func (context *Context) testGreaterOrEqual(arguments []ExpressionArgument) (bool, error) {
+	return context.anyOrdered(arguments[0].Value.([]interface{}), arguments[1].Value, func(order int) bool {
+		return order >= 0
+	})
+}
 
-		if f0 < f1 {
-			return true
-		}
+func (context *Context) testLessOrEqual(arguments []ExpressionArgument) (bool, error) {
+	return context.anyOrdered(arguments[0].Value.([]interface{}), arguments[1].Value, func(order int) bool {
+		return order <= 0
+	})
+}
+
+// checkBetween checks that the mode of between is one it knows
+func checkBetween(arguments []ExpressionArgument) error {
+	if len(arguments) > 3 && arguments[3].Value != "inclusive" && arguments[3].Value != "exclusive" {
+		return fmt.Errorf("unknown mode %q, expected 'inclusive' or 'exclusive'", arguments[3].Value)
 	}
-	return false
+	return nil
 }
 
-func testGreaterOrEqual(arguments []ExpressionArgument) bool {
+func (context *Context) testBetween(arguments []ExpressionArgument) (bool, error) {
+	if error := checkBetween(arguments); error != nil {
+		return false, error
+	}
 	matches := arguments[0].Value.([]interface{})
-
-	_, f1 := FloatCast(arguments[1].Value)
+	inclusive := len(arguments) > 3 && arguments[3].Value == "inclusive"
 
 	for _, match := range matches {
-		error, f0 := FloatCast(match)
+		lower, error := context.compare(match, arguments[1].Value)
 		if error != nil {
+			return false, error
+		} else if lower == unordered {
+			continue
+		}
+		upper, error := context.compare(match, arguments[2].Value)
+		if error != nil {
+			return false, error
+		} else if upper == unordered {
 			continue
 		}
 
-		if f0 >= f1 {
-			return true
+		if lower > 0 && upper < 0 || inclusive && lower >= 0 && upper <= 0 {
+			return true, nil
 		}
 	}
-	return false
+	return false, nil
 }
 
-func testLessOrEqual(arguments []ExpressionArgument) bool {
-	matches := arguments[0].Value.([]interface{})
-
-	_, f1 := FloatCast(arguments[1].Value)
-
-	for _, match := range matches {
-		error, f0 := FloatCast(match)
-		if error != nil {
-			continue
-		}
-
-		if f0 <= f1 {
-			return true
+// sizeTest creates a condition that runs test with the lengths of the matches,
+// see the length value function, in place of the matches.
+func sizeTest(test func(context *Context, arguments []ExpressionArgument) (bool, error)) func(context *Context, arguments []ExpressionArgument) (bool, error) {
+	return func(context *Context, arguments []ExpressionArgument) (bool, error) {
+		sized := make([]ExpressionArgument, len(arguments))
+		copy(sized, arguments)
+		sized[0] = ExpressionArgument{
+			Type:  PathArg,
+			Value: valueLength(arguments[:1]),
 		}
+		return test(context, sized)
 	}
-	return false
 }
 
-func testBetween(arguments []ExpressionArgument) bool {
-	matches := arguments[0].Value.([]interface{})
+// unordered is the order of values that can't be compared
+const unordered = -2
 
-	_, f1 := FloatCast(arguments[1].Value)
-	_, f2 := FloatCast(arguments[2].Value)
+// compare orders match in relation to value, see Compare. Values that can't
+// be compared are unordered, or an error in strict mode.
+func (context *Context) compare(match interface{}, value interface{}) (int, error) {
+	order, error := Compare(match, value)
+	if error != nil {
+		if context.Strict {
+			return unordered, fmt.Errorf("can't compare %#v with %#v: %v", match, value, error)
+		}
+		return unordered, nil
+	}
+	return order, nil
+}
 
+// anyOrdered checks if the order of any of the matches compared to value
+// satisfies test, matches that can't be compared to value are skipped.
+func (context *Context) anyOrdered(matches []interface{}, value interface{}, test func(order int) bool) (bool, error) {
 	for _, match := range matches {
-		error, f0 := FloatCast(match)
+		order, error := context.compare(match, value)
 		if error != nil {
+			return false, error
+		} else if order == unordered {
 			continue
 		}
 
-		if f0 > f1 && f0 < f2 {
-			return true
+		if test(order) {
+			return true, nil
 		}
 	}
-	return false
+	return false, nil
 }
 
 // NewContext creates a new evaluation context
@@ -233,12 +581,41 @@ func NewContext() *Context {
 	// Set up standard condition functions
 	context.ConditionFunctions = map[string]*ConditionFunction{
 		"eq": &ConditionFunction{
-			TestFunction: testEquals,
+			contextTest: (*Context).testEquals,
+			Arguments: []int{
+				PathArg,
+				LiteralArg,
+			},
+		},
+		"ne": &ConditionFunction{
+			contextTest: (*Context).testNotEquals,
 			Arguments: []int{
 				PathArg,
 				LiteralArg,
 			},
 		},
+		"in": &ConditionFunction{
+			contextTest: (*Context).testIn,
+			Arguments: []int{
+				PathArg,
+				ArrayArg,
+			},
+		},
+		"nin": &ConditionFunction{
+			contextTest: (*Context).testNotIn,
+			Arguments: []int{
+				PathArg,
+				ArrayArg,
+			},
+		},
+		"oneOf": &ConditionFunction{
+			contextTest: (*Context).testOneOf,
+			Arguments: []int{
+				PathArg,
+				LiteralArg,
+			},
+			Variadic: true,
+		},
 		"contains": &ConditionFunction{
 			TestFunction: testContains,
 			Arguments: []int{
@@ -254,46 +631,142 @@ func NewContext() *Context {
 			},
 		},
 		"gt": &ConditionFunction{
-			TestFunction: testGreater,
+			contextTest: (*Context).testGreater,
 			Arguments: []int{
 				PathArg,
-				FloatArg,
+				FloatArg | StringArg,
 			},
 		},
 		"lt": &ConditionFunction{
-			TestFunction: testLess,
+			contextTest: (*Context).testLess,
 			Arguments: []int{
 				PathArg,
-				FloatArg,
+				FloatArg | StringArg,
 			},
 		},
 		"gte": &ConditionFunction{
-			TestFunction: testGreaterOrEqual,
+			contextTest: (*Context).testGreaterOrEqual,
 			Arguments: []int{
 				PathArg,
-				FloatArg,
+				FloatArg | StringArg,
 			},
 		},
 		"lte": &ConditionFunction{
-			TestFunction: testLessOrEqual,
+			contextTest: (*Context).testLessOrEqual,
 			Arguments: []int{
 				PathArg,
-				FloatArg,
+				FloatArg | StringArg,
 			},
 		},
 		"between": &ConditionFunction{
-			TestFunction: testBetween,
+			contextTest: (*Context).testBetween,
+			Arguments: []int{
+				PathArg,
+				FloatArg | StringArg,
+				FloatArg | StringArg,
+				StringArg,
+			},
+			Defaults: []ExpressionArgument{
+				{Type: StringArg, Value: "exclusive"},
+			},
+			check: checkBetween,
+		},
+		"startsWith": &ConditionFunction{
+			TestFunction: stringTest(false, strings.HasPrefix),
+			Arguments: []int{
+				PathArg,
+				StringArg,
+			},
+		},
+		"ciStartsWith": &ConditionFunction{
+			TestFunction: stringTest(true, strings.HasPrefix),
+			Arguments: []int{
+				PathArg,
+				StringArg,
+			},
+		},
+		"endsWith": &ConditionFunction{
+			TestFunction: stringTest(false, strings.HasSuffix),
+			Arguments: []int{
+				PathArg,
+				StringArg,
+			},
+		},
+		"ciEndsWith": &ConditionFunction{
+			TestFunction: stringTest(true, strings.HasSuffix),
 			Arguments: []int{
 				PathArg,
-				FloatArg,
-				FloatArg,
+				StringArg,
 			},
 		},
+		"glob": &ConditionFunction{
+			TestFunction: stringTest(false, globMatch),
+			Arguments: []int{
+				PathArg,
+				StringArg,
+			},
+		},
+		"ciGlob": &ConditionFunction{
+			TestFunction: stringTest(true, globMatch),
+			Arguments: []int{
+				PathArg,
+				StringArg,
+			},
+		},
+		"sizeEq": &ConditionFunction{
+			contextTest: sizeTest((*Context).testEquals),
+			Arguments: []int{
+				PathArg,
+				IntegerArg,
+			},
+		},
+		"sizeGt": &ConditionFunction{
+			contextTest: sizeTest((*Context).testGreater),
+			Arguments: []int{
+				PathArg,
+				IntegerArg,
+			},
+		},
+		"sizeGte": &ConditionFunction{
+			contextTest: sizeTest((*Context).testGreaterOrEqual),
+			Arguments: []int{
+				PathArg,
+				IntegerArg,
+			},
+		},
+		"sizeLt": &ConditionFunction{
+			contextTest: sizeTest((*Context).testLess),
+			Arguments: []int{
+				PathArg,
+				IntegerArg,
+			},
+		},
+		"sizeLte": &ConditionFunction{
+			contextTest: sizeTest((*Context).testLessOrEqual),
+			Arguments: []int{
+				PathArg,
+				IntegerArg,
+			},
+		},
+		"sizeBetween": &ConditionFunction{
+			contextTest: sizeTest((*Context).testBetween),
+			Arguments: []int{
+				PathArg,
+				IntegerArg,
+				IntegerArg,
+				StringArg,
+			},
+			Defaults: []ExpressionArgument{
+				{Type: StringArg, Value: "exclusive"},
+			},
+			check: checkBetween,
+		},
 		"has": &ConditionFunction{
 			TestFunction: testHas,
 			Arguments: []int{
 				PathArg,
 			},
+			firstValue: true,
 		},
 		"empty": &ConditionFunction{
 			TestFunction: testEmpty,
@@ -301,6 +774,76 @@ func NewContext() *Context {
 				PathArg,
 			},
 		},
+		"isString": &ConditionFunction{
+			TestFunction: typeTest("string"),
+			Arguments: []int{
+				PathArg,
+			},
+		},
+		"isNumber": &ConditionFunction{
+			TestFunction: typeTest("integer", "float"),
+			Arguments: []int{
+				PathArg,
+			},
+		},
+		"isBool": &ConditionFunction{
+			TestFunction: typeTest("bool"),
+			Arguments: []int{
+				PathArg,
+			},
+		},
+		"isArray": &ConditionFunction{
+			TestFunction: typeTest("array"),
+			Arguments: []int{
+				PathArg,
+			},
+		},
+		"isObject": &ConditionFunction{
+			TestFunction: typeTest("object"),
+			Arguments: []int{
+				PathArg,
+			},
+		},
+		"isNull": &ConditionFunction{
+			TestFunction: typeTest("null"),
+			Arguments: []int{
+				PathArg,
+			},
+		},
+	}
+
+	// Set up standard value functions
+	context.ValueFunctions = map[string]*ValueFunction{
+		"length": &ValueFunction{
+			Function: valueLength,
+			Arguments: []int{
+				PathArg,
+			},
+		},
+		"lower": &ValueFunction{
+			Function: valueLower,
+			Arguments: []int{
+				PathArg,
+			},
+		},
+		"count": &ValueFunction{
+			Function: valueCount,
+			Arguments: []int{
+				PathArg,
+			},
+		},
+		"keys": &ValueFunction{
+			Function: valueKeys,
+			Arguments: []int{
+				PathArg,
+			},
+		},
+		"type": &ValueFunction{
+			Function: valueType,
+			Arguments: []int{
+				PathArg,
+			},
+		},
 	}
 
 	return &context
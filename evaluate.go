@@ -1,96 +1,468 @@
 package obpath
 
 import (
+	"encoding/json"
+	"fmt"
 	"reflect"
+	"sort"
+	"strings"
 )
 
-// Evaluate finds everything matching an expression
+// EvaluationError describes an error that happened while evaluating a path,
+// like a condition or value function failing.
+type EvaluationError struct {
+	// Path is the path expression that was evaluated
+	Path string
+	// Step is the index of the path step that was evaluated
+	Step int
+	// Location is the location of the item being evaluated as a path expression
+	Location string
+	// Err is the underlying error
+	Err error
+}
+
+// The error message
+func (error *EvaluationError) Error() string {
+	return fmt.Sprintf("error evaluating path %q at %v: %v", error.Path, error.Location, error.Err)
+}
+
+// Unwrap returns the underlying error
+func (error *EvaluationError) Unwrap() error {
+	return error.Err
+}
+
+// location is a linked list of the keys, fields and indexes leading to an item
+type location struct {
+	parent *location
+	name   string
+	index  int
+	depth  int
+	// ref identifies the map, slice or pointer at the location, so that
+	// descendant steps can tell when they're back at it
+	ref reference
+}
+
+// reference identifies a map, slice or pointer
+type reference struct {
+	valid   bool
+	pointer uintptr
+	length  int
+	t       reflect.Type
+}
+
+// referenceTo gets the reference of a map, slice or pointer value, other
+// values get an invalid reference.
+func referenceTo(v reflect.Value) reference {
+	for v.Kind() == reflect.Interface && !v.IsNil() {
+		v = v.Elem()
+	}
+
+	switch v.Kind() {
+	case reflect.Map, reflect.Ptr:
+		if !v.IsNil() {
+			return reference{valid: true, pointer: v.Pointer(), t: v.Type()}
+		}
+	case reflect.Slice:
+		if !v.IsNil() && v.Len() > 0 {
+			return reference{valid: true, pointer: v.Pointer(), length: v.Len(), t: v.Type()}
+		}
+	}
+	return reference{}
+}
+
+// isCycle checks if the reference is the same as the reference of a location
+// or one of its parents
+func (ref reference) isCycle(at *location) bool {
+	if !ref.valid {
+		return false
+	}
+	for ; at != nil; at = at.parent {
+		if at.ref == ref {
+			return true
+		}
+	}
+	return false
+}
+
+func (at *location) child(name string) *location {
+	return &location{parent: at, name: name, index: -1, depth: at.getDepth() + 1}
+}
+
+func (at *location) item(index int) *location {
+	return &location{parent: at, index: index, depth: at.getDepth() + 1}
+}
+
+// getDepth gets the depth below the root, which is at depth 0
+func (at *location) getDepth() int {
+	if at == nil {
+		return 0
+	}
+	return at.depth
+}
+
+func (at *location) String() string {
+	if at == nil {
+		return "(root)"
+	}
+
+	segments := []string{}
+	for ; at != nil; at = at.parent {
+		if at.index >= 0 {
+			segments = append(segments, fmt.Sprintf("[%d]", at.index))
+		} else {
+			segments = append(segments, "."+at.name)
+		}
+	}
+
+	for i, j := 0, len(segments)-1; i < j; i, j = i+1, j-1 {
+		segments[i], segments[j] = segments[j], segments[i]
+	}
+	return strings.Join(segments, "")
+}
+
+// evaluation is the state of a single evaluation of a path
+type evaluation struct {
+	path *Path
+	// emit gets the matches and where they were found
+	emit func(match interface{}, at *location)
+	// firstOnly stops the evaluation at the first match
+	firstOnly bool
+	// done is set when the evaluation stopped before going through everything
+	done bool
+	// stopOnError stops the evaluation at the first error, otherwise items
+	// that fail are skipped
+	stopOnError bool
+	// strict makes steps that can't be applied to an item errors
+	strict bool
+	error  *EvaluationError
+	// explanation, when set, gets a report of the evaluation
+	explanation *Explanation
+	limits      Limits
+	budget      *budget
+	// root is the reference of the root object, if any
+	root reference
+	// reportCycles makes cycles errors
+	reportCycles bool
+	// sortKeys makes map keys iterate in order
+	sortKeys bool
+	// decodeBytes makes byte slices decoded as JSON
+	decodeBytes bool
+	// concurrency is the number of items of item steps evaluated in parallel
+	concurrency int
+}
+
+// newEvaluation sets up an evaluation of the path with the context options
+func (path *Path) newEvaluation(emit func(match interface{}, at *location)) *evaluation {
+	return &evaluation{
+		path:   path,
+		emit:   emit,
+		strict: path.context.Strict,
+		limits: path.context.Limits,
+		budget: &budget{},
+
+		reportCycles: path.context.ReportCycles,
+		sortKeys:     path.context.SortKeys,
+		decodeBytes:  path.context.DecodeBytes,
+		concurrency:  path.context.Concurrency,
+	}
+}
+
+// Evaluate finds everything matching an expression. Items for which a
+// condition or value function fails are skipped, use Matches to get the
+// errors. Evaluation stops when a limit is exceeded.
 func (path *Path) Evaluate(object interface{}, result chan<- interface{}) {
-	path.evaluateStep(0, object, result)
+	e := path.newEvaluation(func(match interface{}, at *location) {
+		result <- match
+	})
+	e.run(object, nil)
 	close(result)
 }
 
-func (path *Path) checkAndEvaluateNextStep(index int, object interface{}, result chan<- interface{}) {
-	step := path.steps[index]
+// Matches finds everything matching an expression. Evaluation stops at the
+// first error, which is returned as an *EvaluationError along with the
+// matches found before it.
+func (path *Path) Matches(object interface{}) ([]interface{}, error) {
+	matches := []interface{}{}
+	e := path.newEvaluation(func(match interface{}, at *location) {
+		matches = append(matches, match)
+	})
+	e.stopOnError = true
+	e.run(object, nil)
+
+	if e.error != nil {
+		return matches, e.error
+	}
+	return matches, nil
+}
+
+// run evaluates the path against an object at a location
+func (e *evaluation) run(object interface{}, at *location) {
+	if at == nil {
+		e.root = referenceTo(reflect.ValueOf(object))
+	}
+	e.evaluateStep(0, object, at)
+}
+
+// fail records an error, the first error stops the evaluation if stopOnError
+// is set or if a limit was exceeded
+func (e *evaluation) fail(index int, at *location, err error) {
+	if e.explanation != nil && index < len(e.explanation.Steps) {
+		report := e.explanation.Steps[index]
+		report.Errors = append(report.Errors, fmt.Sprintf("at %v: %v", at, err))
+	}
+
+	_, isLimit := err.(*LimitError)
+	if (e.stopOnError || isLimit) && e.error == nil {
+		e.done = true
+		e.error = &EvaluationError{
+			Path:     e.path.path,
+			Step:     index,
+			Location: at.String(),
+			Err:      err,
+		}
+	}
+}
+
+// mismatch fails the evaluation in strict mode when a step can't be applied
+// to an item. Descendant steps are expected not to apply to most items.
+func (e *evaluation) mismatch(index int, at *location, format string, args ...interface{}) {
+	if e.strict && e.path.steps[index].target != "descendant" {
+		e.fail(index, at, fmt.Errorf(format, args...))
+	}
+}
+
+func (e *evaluation) checkAndEvaluateNextStep(index int, object interface{}, at *location) {
+	// Stop evaluating after an error or the first match if that's all we need
+	if e.done {
+		return
+	}
+
+	at.ref = referenceTo(reflect.ValueOf(object))
+	step := e.path.steps[index]
+	if e.explanation != nil {
+		e.explanation.Steps[index].Selected++
+	}
 
 	if step.condition != nil {
-		args := make([]ExpressionArgument, len(step.condition.Arguments))
-		for idx, arg := range step.condition.Arguments {
-			if arg.Type&PathArg == PathArg {
-				path := arg.Value.(*Path)
-				result := make(chan interface{})
-				go path.Evaluate(object, result)
-
-				values := []interface{}{}
-				for item := range result {
-					values = append(values, item)
-				}
-				args[idx] = ExpressionArgument{
-					Type:  PathArg,
-					Value: values,
-				}
-			} else {
-				args[idx] = arg
-			}
+		args, err := e.resolveArguments(step.condition.Arguments, object, at, step.condition.firstValueOnly())
+		if err != nil {
+			e.fail(index, at, err)
+			return
 		}
 
-		match := step.condition.Condition.TestFunction(args)
+		match, err := step.condition.test(e.path.context, args)
+		if err != nil {
+			e.fail(index, at, err)
+			return
+		}
 		if step.condition.Inverse {
 			match = !match
 		}
 		if match {
-			path.evaluateStep(index+1, object, result)
+			e.passed(index)
+			e.evaluateStep(index+1, object, at)
+		} else if e.explanation != nil {
+			report := e.explanation.Steps[index]
+			report.Dropped = append(report.Dropped, DroppedItem{
+				Location:  at.String(),
+				Arguments: args,
+				Reason:    step.condition.describeFailure(),
+			})
 		}
 	} else {
-		path.evaluateStep(index+1, object, result)
+		e.passed(index)
+		e.evaluateStep(index+1, object, at)
+	}
+}
+
+// passed counts items passed on by a step when explaining
+func (e *evaluation) passed(index int) {
+	if e.explanation != nil {
+		e.explanation.Steps[index].Passed++
+	}
+}
+
+// resolveArguments evaluates path references and value function calls
+// relative to object. When firstOnly is set path references only get their
+// first value.
+func (e *evaluation) resolveArguments(arguments []ExpressionArgument, object interface{}, at *location, firstOnly bool) ([]ExpressionArgument, error) {
+	args := make([]ExpressionArgument, len(arguments))
+	for idx, arg := range arguments {
+		switch value := arg.Value.(type) {
+		case *Path:
+			values := []interface{}{}
+			sub := &evaluation{
+				path: value,
+				emit: func(match interface{}, at *location) {
+					values = append(values, match)
+				},
+				firstOnly:   firstOnly,
+				stopOnError: true,
+				limits:      e.limits,
+				budget:      e.budget,
+				sortKeys:    e.sortKeys,
+				decodeBytes: e.decodeBytes,
+			}
+			// Matches of paths in arguments aren't results
+			sub.limits.MaxResults = 0
+			sub.run(object, at)
+
+			if sub.error != nil {
+				return nil, sub.error.Err
+			}
+
+			args[idx] = ExpressionArgument{
+				Type:  PathArg,
+				Value: values,
+			}
+		case *valueCall:
+			callArgs, err := e.resolveArguments(value.Arguments, object, at, false)
+			if err != nil {
+				return nil, err
+			}
+
+			values, err := value.Function.call(callArgs)
+			if err != nil {
+				return nil, err
+			}
+
+			args[idx] = ExpressionArgument{
+				Type:  PathArg,
+				Value: values,
+			}
+		default:
+			args[idx] = arg
+		}
+	}
+	return args, nil
+}
+
+// result emits a match, unless it's past the result limit
+func (e *evaluation) result(object interface{}, at *location) {
+	// Evaluations of paths in arguments have no result limit and aren't counted
+	if e.limits.MaxResults > 0 {
+		if exceeded(e.budget.match(), e.limits.MaxResults) {
+			e.fail(len(e.path.steps), at, &LimitError{"MaxResults", e.limits.MaxResults})
+			return
+		}
+	}
+
+	e.emit(object, at)
+	// The emit function may have stopped the evaluation too
+	if e.firstOnly {
+		e.done = true
 	}
 }
 
-func (path *Path) evaluateStep(index int, object interface{}, result chan<- interface{}) {
-	if index >= len(path.steps) {
-		result <- object
+func (e *evaluation) evaluateStep(index int, object interface{}, at *location) {
+	// Stop evaluating after an error or the first match if that's all we need
+	if e.done {
+		return
+	}
+
+	if exceeded(e.budget.visit(), e.limits.MaxNodes) {
+		e.fail(index, at, &LimitError{"MaxNodes", e.limits.MaxNodes})
+		return
+	}
+	if exceeded(at.getDepth(), e.limits.MaxDepth) {
+		e.fail(index, at, &LimitError{"MaxDepth", e.limits.MaxDepth})
+		return
+	}
+
+	if index >= len(e.path.steps) {
+		e.result(object, at)
+		return
+	}
+
+	if e.explanation != nil {
+		e.explanation.Steps[index].Entered++
+	}
+
+	// Raw JSON is decoded when stepping into it
+	if raw, isRaw := e.rawJSON(object); isRaw {
+		var decoded interface{}
+		if len(raw) > 0 {
+			if err := json.Unmarshal(raw, &decoded); err != nil {
+				e.fail(index, at, fmt.Errorf("can't decode JSON: %v", err))
+				return
+			}
+		}
+		object = decoded
+	}
+
+	// There is nothing to step into in a null value
+	if object == nil {
+		e.mismatch(index, at, "can't step into null")
+		return
+	}
+
+	if e.evaluateGeneric(index, object, at) {
 		return
 	}
 
 	zero := reflect.ValueOf(nil)
-	step := path.steps[index]
-	kind := reflect.TypeOf(object).Kind()
+	step := e.path.steps[index]
 	v := reflect.ValueOf(object)
 
+	// Step through pointers to the values they point to
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			e.mismatch(index, at, "can't step into null")
+			return
+		}
+		v = v.Elem()
+	}
+	kind := v.Kind()
+
 	if step.target == "child" || step.target == "descendant" {
 		// We're looking for map item or struct fields
 
 		if step.name == "*" {
 			// Iterate over all child fields, keys or items.
 			if kind == reflect.Map {
-				for _, key := range v.MapKeys() {
+				for _, key := range e.mapKeys(v) {
 					child := v.MapIndex(key)
-					path.checkAndEvaluateNextStep(index, child.Interface(), result)
+					e.checkAndEvaluateNextStep(index, child.Interface(), at.child(fmt.Sprint(key.Interface())))
 				}
 			} else if kind == reflect.Struct {
-				length := v.NumField()
-				for i := 0; i < length; i++ {
-					path.checkAndEvaluateNextStep(index, v.Field(i).Interface(), result)
+				for i, field := range fieldsOf(v.Type()).fields {
+					if field.exported {
+						e.checkAndEvaluateNextStep(index, v.Field(i).Interface(), at.child(field.name))
+					}
 				}
 			} else if kind == reflect.Array || kind == reflect.Slice {
 				length := v.Len()
 				for i := 0; i < length; i++ {
-					path.checkAndEvaluateNextStep(index, v.Index(i).Interface(), result)
+					e.checkAndEvaluateNextStep(index, v.Index(i).Interface(), at.item(i))
 				}
+			} else {
+				e.mismatch(index, at, "can't get the children of a %v", kind)
 			}
 		} else {
 			// Step to a named child key or field.
-			if kind == reflect.Map {
-				child := v.MapIndex(reflect.ValueOf(step.name))
+			if kind == reflect.Map && v.Type().Key().Kind() == reflect.String {
+				child := v.MapIndex(reflect.ValueOf(step.name).Convert(v.Type().Key()))
 
 				if child != zero {
-					path.checkAndEvaluateNextStep(index, child.Interface(), result)
+					e.checkAndEvaluateNextStep(index, child.Interface(), at.child(step.name))
+				} else {
+					e.mismatch(index, at, "missing key %q", step.name)
 				}
 			} else if kind == reflect.Struct {
-				child := v.FieldByName(step.name)
-				if child != zero {
-					path.checkAndEvaluateNextStep(index, child.Interface(), result)
+				var child reflect.Value
+				field, found := fieldsOf(v.Type()).lookup(step.name)
+				if found {
+					// Promoted fields of nil embedded pointers are missing
+					child, _ = v.FieldByIndexErr(field.index)
 				}
+
+				if child.IsValid() {
+					e.checkAndEvaluateNextStep(index, child.Interface(), at.child(step.name))
+				} else {
+					e.mismatch(index, at, "missing field %q", step.name)
+				}
+			} else {
+				e.mismatch(index, at, "can't get %q from a %v", step.name, kind)
 			}
 		}
 
@@ -98,18 +470,19 @@ func (path *Path) evaluateStep(index int, object interface{}, result chan<- inte
 		// data structure without moving on to the next path part.
 		if step.target == "descendant" {
 			if kind == reflect.Map {
-				for _, key := range v.MapKeys() {
-					path.evaluateStep(index, v.MapIndex(key).Interface(), result)
+				for _, key := range e.mapKeys(v) {
+					e.descend(index, v.MapIndex(key).Interface(), at.child(fmt.Sprint(key.Interface())))
 				}
 			} else if kind == reflect.Struct {
-				length := v.NumField()
-				for i := 0; i < length; i++ {
-					path.evaluateStep(index, v.Field(i).Interface(), result)
+				for i, field := range fieldsOf(v.Type()).fields {
+					if field.exported {
+						e.descend(index, v.Field(i).Interface(), at.child(field.name))
+					}
 				}
 			} else if kind == reflect.Array || kind == reflect.Slice {
 				length := v.Len()
 				for i := 0; i < length; i++ {
-					path.evaluateStep(index, v.Index(i).Interface(), result)
+					e.descend(index, v.Index(i).Interface(), at.item(i))
 				}
 			}
 		}
@@ -117,15 +490,155 @@ func (path *Path) evaluateStep(index int, object interface{}, result chan<- inte
 		// We're looking for items in an array or slice
 
 		if kind == reflect.Array || kind == reflect.Slice {
-			length := v.Len()
-			startSlice := sliceBound(step.start, length)
-			endSlice := sliceBound(step.end, length)
+			e.evaluateItems(index, v.Len(), at, func(i int) interface{} {
+				return v.Index(i).Interface()
+			})
+		} else {
+			e.mismatch(index, at, "can't index a %v", kind)
+		}
+	}
+}
+
+// rawJSON gets the JSON of json.RawMessage values, and of byte slices if the
+// context says so
+func (e *evaluation) rawJSON(object interface{}) ([]byte, bool) {
+	switch raw := object.(type) {
+	case json.RawMessage:
+		return raw, true
+	case *json.RawMessage:
+		if raw != nil {
+			return *raw, true
+		}
+	case []byte:
+		return raw, e.decodeBytes
+	}
+	return nil, false
+}
+
+// evaluateItems evaluates an item step on an array or slice
+func (e *evaluation) evaluateItems(index int, length int, at *location, item func(int) interface{}) {
+	step := e.path.steps[index]
+	startSlice := sliceBound(step.start, length)
+	endSlice := sliceBound(step.end, length)
+
+	// All items, [*] or [0:], are never out of range
+	if e.strict && !(step.start == 0 && step.end == -1) && (outOfRange(step.start, length) || outOfRange(step.end, length)) {
+		e.mismatch(index, at, "index [%d:%d] out of range with length %d", step.start, step.end, length)
+		return
+	}
 
-			for i := startSlice; i <= endSlice && i < length; i++ {
-				path.checkAndEvaluateNextStep(index, v.Index(i).Interface(), result)
+	if endSlice >= length {
+		endSlice = length - 1
+	}
+	if e.concurrency > 1 && e.explanation == nil && endSlice > startSlice {
+		e.evaluateParallel(index, startSlice, endSlice, at, item)
+		return
+	}
+
+	for i := startSlice; i <= endSlice; i++ {
+		e.checkAndEvaluateNextStep(index, item(i), at.item(i))
+	}
+}
+
+// evaluateGeneric evaluates a step on the maps and slices decoded by
+// encoding/json without reflection, it returns false for other values.
+func (e *evaluation) evaluateGeneric(index int, object interface{}, at *location) bool {
+	step := e.path.steps[index]
+
+	switch value := object.(type) {
+	case map[string]interface{}:
+		if step.target == "item" {
+			e.mismatch(index, at, "can't index a %v", reflect.Map)
+			return true
+		}
+
+		var keys []string
+		if step.name == "*" || step.target == "descendant" {
+			keys = e.stringKeys(value)
+		}
+
+		if step.name == "*" {
+			for _, key := range keys {
+				e.checkAndEvaluateNextStep(index, value[key], at.child(key))
+			}
+		} else if child, found := value[step.name]; found {
+			e.checkAndEvaluateNextStep(index, child, at.child(step.name))
+		} else {
+			e.mismatch(index, at, "missing key %q", step.name)
+		}
+
+		if step.target == "descendant" {
+			for _, key := range keys {
+				e.descend(index, value[key], at.child(key))
 			}
 		}
+	case []interface{}:
+		if step.target == "item" {
+			e.evaluateItems(index, len(value), at, func(i int) interface{} {
+				return value[i]
+			})
+			return true
+		}
+
+		if step.name == "*" {
+			for i, item := range value {
+				e.checkAndEvaluateNextStep(index, item, at.item(i))
+			}
+		} else {
+			e.mismatch(index, at, "can't get %q from a %v", step.name, reflect.Slice)
+		}
+
+		if step.target == "descendant" {
+			for i, item := range value {
+				e.descend(index, item, at.item(i))
+			}
+		}
+	default:
+		return false
+	}
+	return true
+}
+
+// descend continues a descendant step in a child, unless the child is one of
+// the maps, slices or pointers that lead to it, which would never end.
+func (e *evaluation) descend(index int, child interface{}, at *location) {
+	at.ref = referenceTo(reflect.ValueOf(child))
+	if at.ref.isCycle(at.parent) || at.ref.valid && at.ref == e.root {
+		if e.reportCycles {
+			e.fail(index, at, fmt.Errorf("cycle, refers back to a parent value"))
+		}
+		return
+	}
+	e.evaluateStep(index, child, at)
+}
+
+// mapKeys gets the keys of a map, sorted if the context says so
+func (e *evaluation) mapKeys(v reflect.Value) []reflect.Value {
+	keys := v.MapKeys()
+	if e.sortKeys {
+		sortValues(keys)
+	}
+	return keys
+}
+
+// stringKeys gets the keys of a map decoded by encoding/json, sorted if the
+// context says so
+func (e *evaluation) stringKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	if e.sortKeys {
+		sort.Strings(keys)
+	}
+	return keys
+}
+
+func outOfRange(index int, length int) bool {
+	if index < 0 {
+		index = length + index
 	}
+	return index < 0 || index >= length
 }
 
 func sliceBound(index int, length int) int {
@@ -0,0 +1,90 @@
+package obpath
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// Explanation is a report of how a path was evaluated against an object
+type Explanation struct {
+	// Path is the path expression that was evaluated
+	Path string
+	// Steps are the reports for each step of the path
+	Steps []*StepReport
+	// Matches are the items that matched the path
+	Matches []interface{}
+}
+
+// StepReport describes how a single path step was evaluated
+type StepReport struct {
+	// Step is the step as written in the path expression
+	Step string
+	// Entered is the number of items the step was applied to
+	Entered int
+	// Selected is the number of children or items the step selected
+	Selected int
+	// Passed is the number of selected items that passed the condition of
+	// the step, all selected items pass steps without conditions
+	Passed int
+	// Dropped are the selected items that the condition rejected
+	Dropped []DroppedItem
+	// Errors are the errors that happened in the step
+	Errors []string
+}
+
+// DroppedItem is an item that was rejected by a condition
+type DroppedItem struct {
+	// Location is the location of the item as a path expression
+	Location string
+	// Arguments are the resolved arguments that were passed to the condition
+	Arguments []ExpressionArgument
+	// Reason describes why the item was dropped
+	Reason string
+}
+
+// Explain evaluates the path like Evaluate does, and reports how many items
+// each step was applied to, selected and passed on, along with the items
+// dropped by conditions and the arguments the conditions got.
+func (path *Path) Explain(object interface{}) *Explanation {
+	explanation := &Explanation{
+		Path:    path.path,
+		Steps:   make([]*StepReport, len(path.steps)),
+		Matches: []interface{}{},
+	}
+	for index, step := range path.steps {
+		explanation.Steps[index] = &StepReport{Step: step.source}
+	}
+
+	e := path.newEvaluation(func(match interface{}, at *location) {
+		explanation.Matches = append(explanation.Matches, match)
+	})
+	e.explanation = explanation
+	e.run(object, nil)
+
+	return explanation
+}
+
+// String formats the explanation as a readable report
+func (explanation *Explanation) String() string {
+	var report bytes.Buffer
+
+	fmt.Fprintf(&report, "Path %q matched %d items\n", explanation.Path, len(explanation.Matches))
+	for index, step := range explanation.Steps {
+		fmt.Fprintf(&report, "%d. %v: entered %d, selected %d, passed %d\n",
+			index+1, step.Step, step.Entered, step.Selected, step.Passed)
+
+		for _, dropped := range step.Dropped {
+			values := make([]string, len(dropped.Arguments))
+			for i, argument := range dropped.Arguments {
+				values[i] = fmt.Sprintf("%v", argument.Value)
+			}
+			fmt.Fprintf(&report, "   dropped %v: %v, arguments: %v\n",
+				dropped.Location, dropped.Reason, strings.Join(values, ", "))
+		}
+		for _, error := range step.Errors {
+			fmt.Fprintf(&report, "   error %v\n", error)
+		}
+	}
+	return report.String()
+}
@@ -0,0 +1,67 @@
+package obpath
+
+import (
+	"reflect"
+	"sync"
+)
+
+// structField describes a field of a struct type
+type structField struct {
+	name     string
+	index    []int
+	exported bool
+}
+
+// structFields describes the fields of a struct type
+type structFields struct {
+	// fields are the fields of the struct, in declaration order
+	fields []structField
+	// named are the exported fields, including promoted fields of embedded
+	// structs, by name
+	named map[string]structField
+}
+
+// fieldCache has the *structFields of the struct types seen so far, by
+// reflect.Type
+var fieldCache sync.Map
+
+// fieldsOf gets the fields of a struct type, looking them up once per type
+func fieldsOf(t reflect.Type) *structFields {
+	if cached, found := fieldCache.Load(t); found {
+		return cached.(*structFields)
+	}
+
+	fields := &structFields{
+		fields: make([]structField, t.NumField()),
+		named:  map[string]structField{},
+	}
+	for i := range fields.fields {
+		fields.fields[i] = describeField(t.Field(i))
+	}
+
+	for _, visible := range reflect.VisibleFields(t) {
+		// FieldByName resolves fields that are ambiguous because of embedding
+		field, found := t.FieldByName(visible.Name)
+		if !found || !field.IsExported() {
+			continue
+		}
+		fields.named[field.Name] = describeField(field)
+	}
+
+	cached, _ := fieldCache.LoadOrStore(t, fields)
+	return cached.(*structFields)
+}
+
+func describeField(field reflect.StructField) structField {
+	return structField{
+		name:     field.Name,
+		index:    field.Index,
+		exported: field.IsExported(),
+	}
+}
+
+// lookup finds an exported field by its name
+func (fields *structFields) lookup(name string) (structField, bool) {
+	field, found := fields.named[name]
+	return field, found
+}
@@ -22,6 +22,7 @@ func main() {
 	resultsPath := flag.String("expected", "testdata/expect.jsonstream", "Path to file to read expected values from (or write to, when generating)")
 	errorsPath := flag.String("errors", "testdata/syntax_errors.json", "Path to file with path expressions with invalid syntax")
 	generate := flag.Bool("generate", false, "Re-generate the expected values")
+	flag.Parse()
 
 	if *generate {
 		generateExpectedValues(*dataPath, *queriesPath, *resultsPath)
@@ -43,24 +44,19 @@ func generateExpectedValues(dataPath string, queriesPath string, resultsPath str
 
 	result := make(chan pathResult)
 
+	// Write the results in the order of the queries so that the file diffs
+	// cleanly when re-generated
 	for _, queryTuple := range queries.([]interface{}) {
 		tuple := queryTuple.([]interface{})
 		queryName := tuple[0].(string)
 		query := tuple[1].(string)
 
 		go evaluatePath(data, queryName, query, result)
-	}
 
-	count := 0
-	for item := range result {
+		item := <-result
 		if err := enc.Encode(&item); err != nil {
 			log.Println(err)
 		}
-
-		count++
-		if count == len(queries.([]interface{})) {
-			close(result)
-		}
 	}
 }
 
@@ -136,6 +132,7 @@ func readAndDecode(path string, name string) interface{} {
 func evaluatePath(data interface{}, name string, path string, result chan<- pathResult) {
 	context := obpath.NewContext()
 	context.AllowDescendants = true
+	context.SortKeys = true
 	compiled := obpath.MustCompile(path, context)
 
 	results := pathResult{
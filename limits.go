@@ -0,0 +1,61 @@
+package obpath
+
+import (
+	"fmt"
+	"sync/atomic"
+)
+
+// Limits restricts the resources used to compile and evaluate paths, which
+// matters when the paths come from untrusted sources. A zero limit means
+// that there is no limit.
+type Limits struct {
+	// MaxPathLength is the maximum length of a path expression
+	MaxPathLength int
+	// MaxNesting is the maximum nesting of conditions, value function calls
+	// and array literals in a path expression
+	MaxNesting int
+	// MaxDepth is the maximum depth below the root item that is visited
+	MaxDepth int
+	// MaxNodes is the maximum number of items that are visited, including
+	// the items visited to resolve paths in condition arguments
+	MaxNodes int
+	// MaxResults is the maximum number of matches
+	MaxResults int
+}
+
+// LimitError is returned when compiling or evaluating a path exceeds one of
+// the context limits
+type LimitError struct {
+	// Limit is the name of the exceeded limit, like "MaxNodes"
+	Limit string
+	// Max is the value of the exceeded limit
+	Max int
+}
+
+// The error message
+func (error *LimitError) Error() string {
+	return fmt.Sprintf("limit exceeded: %v is %d", error.Limit, error.Max)
+}
+
+// budget keeps track of the resources used by an evaluation and the
+// evaluations of its condition arguments, items evaluated in parallel share
+// it too
+type budget struct {
+	nodes   int64
+	results int64
+}
+
+// visit counts a visited item and returns the count so far
+func (b *budget) visit() int {
+	return int(atomic.AddInt64(&b.nodes, 1))
+}
+
+// match counts a match and returns the count so far
+func (b *budget) match() int {
+	return int(atomic.AddInt64(&b.results, 1))
+}
+
+// exceeded checks if a count is over a limit, zero limits are never exceeded
+func exceeded(count int, max int) bool {
+	return max > 0 && count > max
+}
@@ -3,6 +3,7 @@ package main
 import (
 	"encoding/json"
 	"flag"
+	"fmt"
 	"github.com/bloglovin/obpath"
 	"io"
 	"log"
@@ -12,6 +13,8 @@ import (
 func main() {
 	path := flag.String("path", ".*", "Path expression")
 	stream := flag.Bool("stream", true, "Emit the results as a newline delimited JSON stream")
+	sorted := flag.Bool("sorted", false, "Go through object keys in sorted order, for reproducible results")
+	explain := flag.Bool("explain", false, "Report how the path was evaluated against each document on stderr")
 	flag.Parse()
 
 	dec := json.NewDecoder(os.Stdin)
@@ -19,53 +22,89 @@ func main() {
 
 	context := obpath.NewContext()
 	context.AllowDescendants = true
+	context.SortKeys = *sorted
 
-	compiled, error := obpath.Compile(*path, context)
-	if error != nil {
-		log.Fatalf("Could not compile path: %v", error)
+	compiled, err := obpath.Compile(*path, context)
+	if err != nil {
+		log.Fatalf("Could not compile path: %v", err)
 	}
 
 	index := 0
 	len := 8
 	buffer := make([]interface{}, len)
 
-	for {
-		var input interface{}
-		result := make(chan interface{})
-
-		if err := dec.Decode(&input); err != nil {
-			if err == io.EOF {
-				break
-			} else {
-				log.Fatalf("Read JSON from stdin: %v", error)
-			}
+	result := make(chan interface{})
+	var evaluationError error
+	go func() {
+		if *explain || *sorted {
+			// Keys can only be sorted once the whole document is decoded
+			evaluationError = evaluateEach(dec, compiled, *explain, result)
+		} else {
+			// Only decode as much of the input as is needed for the matches
+			evaluationError = compiled.EvaluateReader(os.Stdin, result)
 		}
-		go compiled.Evaluate(input, result)
+		close(result)
+	}()
 
-		if *stream {
-			for item := range result {
-				if err := enc.Encode(&item); err != nil {
-					log.Println(err)
-				}
+	if *stream {
+		for item := range result {
+			if err := enc.Encode(&item); err != nil {
+				log.Println(err)
 			}
-		} else {
-			for item := range result {
-				if index == len {
-					len *= 2
-					resized := make([]interface{}, len)
-					copy(resized, buffer)
-					buffer = resized
-				}
-				buffer[index] = item
-				index++
+		}
+	} else {
+		for item := range result {
+			if index == len {
+				len *= 2
+				resized := make([]interface{}, len)
+				copy(resized, buffer)
+				buffer = resized
 			}
+			buffer[index] = item
+			index++
 		}
 	}
 
+	if evaluationError != nil {
+		log.Fatalf("Evaluate JSON from stdin: %v", evaluationError)
+	}
+
 	if !(*stream) {
 		slice := buffer[:index]
 		if err := enc.Encode(&slice); err != nil {
-			log.Fatalf("Could not write JSON to stdout: %v", error)
+			log.Fatalf("Could not write JSON to stdout: %v", err)
+		}
+	}
+}
+
+// evaluateEach decodes each document and sends the matches to the result
+// channel. With explain set, how the path was evaluated against each document
+// is reported on stderr.
+func evaluateEach(dec *json.Decoder, compiled *obpath.Path, explain bool, result chan<- interface{}) error {
+	for {
+		var input interface{}
+		if err := dec.Decode(&input); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+
+		if explain {
+			explanation := compiled.Explain(input)
+			fmt.Fprint(os.Stderr, explanation)
+			for _, item := range explanation.Matches {
+				result <- item
+			}
+			continue
+		}
+
+		matches, err := compiled.Matches(input)
+		for _, item := range matches {
+			result <- item
+		}
+		if err != nil {
+			return err
 		}
 	}
 }
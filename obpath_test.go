@@ -1,9 +1,16 @@
 package obpath_test
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
 	"github.com/bloglovin/obpath"
+	"os"
 	"reflect"
+	"sort"
+	"strings"
 	"testing"
+	"time"
 )
 
 type book struct {
@@ -19,8 +26,17 @@ type bike struct {
 	Price float32
 }
 
+type color string
+
+type scooter struct {
+	Color color
+	Price float32
+}
+
 type stringMap map[string]interface{}
 
+type itemList []interface{}
+
 func Test_SyntaxError(t *testing.T) {
 	badPath := ".leftOpen[0"
 	failures := []string{
@@ -37,6 +53,22 @@ func Test_SyntaxError(t *testing.T) {
 		".badArgType2(gt(@.Name, @.Role))",
 		".predicateCutOff(gt(@.Price,2",
 		".epressionCutOff(gt(@.Price,2)",
+		".unknownValueFunction(gt(nope(@.Price), 1))",
+		".badValueArgType(gt(length('foo'), 1))",
+		".valueCutOff(gt(length(@.Title, 1))",
+		".missingArgument(eq(@.Price, ))",
+		".quantifierCutOff(all(gt(@.Price, 5))",
+		".arrayCutOff(in(@.Author, ['a'))",
+		".arrayWithPath(in(@.Author, [@.Title]))",
+		".arrayMissingItem(in(@.Author, ['a', ]))",
+		".floatSize(sizeGt(@.Tags, 1.5))",
+		".betweenTooMany(between(@.Price, 1, 2, 'inclusive', 3))",
+		".betweenTooFew(between(@.Price, 1))",
+		".betweenBadMode(between(@.Price, 1, 2, 'inclusve'))",
+		".sizeBetweenBadMode(sizeBetween(@.Tags, 1, 2, 'Inclusive'))",
+		".oneOfTooFew(oneOf())",
+		".quantifierMissingCondition(all(@.Price))",
+		".badBoolType(gt(@.Price, true))",
 	}
 	context := obpath.NewContext()
 	for _, path := range failures {
@@ -115,6 +147,9 @@ func Test_SampleRun(t *testing.T) {
 			"Metadata": stringMap{
 				"Info": "foobar",
 			},
+			"InStock":   true,
+			"Discount":  nil,
+			"Published": "1851-10-18T00:00:00Z",
 		},
 		stringMap{
 			"Category": "fiction",
@@ -141,38 +176,109 @@ func Test_SampleRun(t *testing.T) {
 	}
 
 	tests := map[string][]interface{}{
-		"[*]":                                                []interface{}{},
-		".store":                                             []interface{}{testData["store"]},
-		".store.books":                                       []interface{}{testData["store"]["books"]},
-		".store.counts[*]":                                   []interface{}{"one", "two", "three", "four"},
-		".store.counts[3]":                                   []interface{}{"four"},
-		".store.counts[3:10]":                                []interface{}{"four"},
-		".store.counts[1:2]":                                 []interface{}{"two", "three"},
-		".store.counts[-2:]":                                 []interface{}{"three", "four"},
-		".store.counts[:1]":                                  []interface{}{"one", "two"},
-		".store.counts[:1].Price":                            []interface{}{},
-		".store.wombats[0:10]":                               []interface{}{},
-		"..books[*](gt(@.Title, 10))":                        []interface{}{},
-		"..books[*](gte(@.Title, 10))":                       []interface{}{},
-		"..books[*](lt(@.Title, 10))":                        []interface{}{},
-		"..books[*](lte(@.Title, 10))":                       []interface{}{},
-		"..books[*](between(@.Title, 10, 20))":               []interface{}{},
-		"..books[*](lt(@.Price, 6)).Title":                   []interface{}{"Westward the Tide"},
-		"..books[*](lte(@.Price, 6)).Title":                  []interface{}{"Westward the Tide"},
-		"..books[*](between(@.Price, 12, 13)).Title":         []interface{}{"Sword of Honour"},
-		"..books[*](has(@.ISBN))":                            books[1:],
-		".store.books[*](!empty(@.ISBN))":                    books[2:],
-		".store.books[*](eq(@.Price, 8.99))":                 books[3:4],
-		".store.books[0:4](eq(@.Author, \"Louis L'Amour\"))": books[2:3],
-		"..books[*](has(@.Metadata))":                        books[3:4],
-		"..books[*](nonfiction(@.Category))":                 books[0:1],
-		"..books[*](contains(@.Title, 'R')).Title":           []interface{}{"The Lord of the Rings"},
-		".store.*[*](gt(@.Price, 18))":                       []interface{}{books[4], bikes[0]},
-		".store.*[*](gte(@.Price, 18))":                      []interface{}{books[4], bikes[0]},
-		"..bicycles[0].*":                                    []interface{}{"red", bikes[0].Price},
+		"[*]":                                                            []interface{}{},
+		".store":                                                         []interface{}{testData["store"]},
+		".store.books":                                                   []interface{}{testData["store"]["books"]},
+		".store.counts[*]":                                               []interface{}{"one", "two", "three", "four"},
+		".store.counts[3]":                                               []interface{}{"four"},
+		".store.counts[3:10]":                                            []interface{}{"four"},
+		".store.counts[1:2]":                                             []interface{}{"two", "three"},
+		".store.counts[-2:]":                                             []interface{}{"three", "four"},
+		".store.counts[:1]":                                              []interface{}{"one", "two"},
+		".store.counts[:1].Price":                                        []interface{}{},
+		".store.wombats[0:10]":                                           []interface{}{},
+		"..books[*](gt(@.Title, 10))":                                    []interface{}{},
+		"..books[*](gte(@.Title, 10))":                                   []interface{}{},
+		"..books[*](lt(@.Title, 10))":                                    []interface{}{},
+		"..books[*](lte(@.Title, 10))":                                   []interface{}{},
+		"..books[*](between(@.Title, 10, 20))":                           []interface{}{},
+		"..books[*](lt(@.Price, 6)).Title":                               []interface{}{"Westward the Tide"},
+		"..books[*](lte(@.Price, 6)).Title":                              []interface{}{"Westward the Tide"},
+		"..books[*](between(@.Price, 12, 13)).Title":                     []interface{}{"Sword of Honour"},
+		"..books[*](has(@.ISBN))":                                        books[1:],
+		".store.books[*](!empty(@.ISBN))":                                books[2:],
+		".store.books[*](eq(@.Price, 8.99))":                             books[3:4],
+		".store.books[0:4](eq(@.Author, \"Louis L'Amour\"))":             books[2:3],
+		"..books[*](has(@.Metadata))":                                    books[3:4],
+		"..books[*](nonfiction(@.Category))":                             books[0:1],
+		"..books[*](contains(@.Title, 'R')).Title":                       []interface{}{"The Lord of the Rings"},
+		".store.*[*](gt(@.Price, 18))":                                   []interface{}{bikes[0], books[4]},
+		".store.*[*](gte(@.Price, 18))":                                  []interface{}{bikes[0], books[4]},
+		"..bicycles[0].*":                                                []interface{}{"red", bikes[0].Price},
+		"..bicycles[*](eq(@.Color, 'red'))":                              []interface{}{bikes[0]},
+		".store.books[*](eq(@.Price, 5.52)).Title":                       []interface{}{"Westward the Tide"},
+		".store.books[*](eq(length(@.Title), 9)).Title":                  []interface{}{"Moby Dick"},
+		".store.books[*](ne(@.Category, 'fiction')).Title":               []interface{}{"Sayings of the Century"},
+		"..books[*](eq(@.InStock, true)).Title":                          []interface{}{"Moby Dick"},
+		"..books[*](eq(@.InStock, false)).Title":                         []interface{}{},
+		"..books[*](eq(@.Discount, null)).Title":                         []interface{}{"Moby Dick"},
+		"..books[*](has(@.Discount.Amount))":                             []interface{}{},
+		"..books[*](lt(@.Author, 'F')).Title":                            []interface{}{"Sword of Honour"},
+		"..books[*](lt(@.Published, '1900-01-01T00:00:00+01:00')).Title": []interface{}{"Moby Dick"},
+		"..books[*](gt(@.Published, '1851-10-17T23:30:00-01:00')).Title": []interface{}{},
+		"..books[*](between(@.Title, 'M', 'T')).Title": []interface{}{
+			"Sayings of the Century",
+			"Sword of Honour",
+			"Moby Dick",
+		},
+		".store(all(gt(@.books[*].Price, 5))).counts[0]":                  []interface{}{"one"},
+		".store(all(gt(@.books[*].Price, 6))).counts[0]":                  []interface{}{},
+		".store(any(gt(@.books[*].Price, 22))).counts[0]":                 []interface{}{"one"},
+		".store(none(gt(@.books[*].Price, 30))).counts[0]":                []interface{}{"one"},
+		".store(!none(gt(@.books[*].Price, 22))).counts[0]":               []interface{}{"one"},
+		"..books[*](nin(@.Category, ['fiction'])).Title":                  []interface{}{"Sayings of the Century"},
+		"..books[*](in(@.Author, [])).Title":                              []interface{}{},
+		".store(eq(@.counts, ['one', 'two', 'three', 'four'])).counts[0]": []interface{}{"one"},
+		"..books[*](in(@.Author, ['Herman Melville', 'Nigel Rees'])).Title": []interface{}{
+			"Sayings of the Century",
+			"Moby Dick",
+		},
+		"..books[*](in(length(@.Title), [9, 15.0])).Title": []interface{}{
+			"Sword of Honour",
+			"Moby Dick",
+		},
+		"..books[*](isNull(@.Discount)).Title":                     []interface{}{"Moby Dick"},
+		"..books[*](isBool(@.InStock)).Title":                      []interface{}{"Moby Dick"},
+		".store.books[*](isObject(@.Metadata)).Title":              []interface{}{"Moby Dick"},
+		".store.counts[*](isNumber(@))":                            []interface{}{},
+		".store(isArray(@.counts)).counts[0]":                      []interface{}{"one"},
+		".store(eq(type(@.books[0]), 'object')).counts[0]":         []interface{}{"one"},
+		".store(eq(type(count(@.books[*])), 'integer')).counts[0]": []interface{}{"one"},
+		".store.books[*](eq(type(@.Price), 'float')).Category":     []interface{}{"reference", "fiction", "fiction", "fiction", "fiction"},
+		"..books[*](isString(@.ISBN)).Title": []interface{}{
+			"Sword of Honour",
+			"Westward the Tide",
+			"Moby Dick",
+			"The Lord of the Rings",
+		},
+		"..books[*](startsWith(@.Title, 'S')).Title":                      []interface{}{"Sayings of the Century", "Sword of Honour"},
+		"..books[*](endsWith(@.Author, 'Rees')).Title":                    []interface{}{"Sayings of the Century"},
+		"..books[*](ciStartsWith(@.Title, 'the')).Title":                  []interface{}{"The Lord of the Rings"},
+		"..books[*](ciEndsWith(@.Title, 'DICK')).Title":                   []interface{}{"Moby Dick"},
+		"..books[*](glob(@.ISBN, '0-553-*')).Title":                       []interface{}{"Westward the Tide", "Moby Dick"},
+		"..books[*](ciGlob(@.Title, 's*')).Title":                         []interface{}{"Sayings of the Century", "Sword of Honour"},
+		"..books[*](sizeGt(@.Title, 20)).Title":                           []interface{}{"Sayings of the Century", "The Lord of the Rings"},
+		"..books[*](sizeLte(@.Title, 9)).Title":                           []interface{}{"Moby Dick"},
+		".store.books[*](sizeGte(@.Metadata, 1)).Title":                   []interface{}{"Moby Dick"},
+		".store(sizeEq(@.counts, 4)).counts[0]":                           []interface{}{"one"},
+		".store(sizeLt(@.wombats, 1)).counts[0]":                          []interface{}{"one"},
+		".store(sizeBetween(@.books, 4, 6)).counts[0]":                    []interface{}{"one"},
+		"..books[*](between(@.Price, 8.95, 8.99)).Title":                  []interface{}{},
+		"..books[*](between(@.Price, 8.95, 8.99, 'inclusive')).Title":     []interface{}{"Sayings of the Century", "Moby Dick"},
+		"..books[*](oneOf(@.Author, 'Nigel Rees', 'Evelyn Waugh')).Title": []interface{}{"Sayings of the Century", "Sword of Honour"},
+		"..books[*](oneOf(@.Author)).Title":                               []interface{}{},
+		".store(sizeBetween(@.counts, 3, 4, 'inclusive')).counts[0]":      []interface{}{"one"},
+		".store.counts[*](contains(@, 'o'))":                              []interface{}{"one", "two", "four"},
+		"..books[*](contains(lower(@.Author), 'melville'))":               books[3:4],
+		".store(gt(count(@.books[*]), 4)).counts[0]":                      []interface{}{"one"},
+		".store.books[*](gt(count(keys(@)), 5)).Title":                    []interface{}{"Moby Dick"},
+		"..books[*](gt(length(@.Title), 20)).Title": []interface{}{
+			"Sayings of the Century",
+			"The Lord of the Rings",
+		},
 		".store.*": []interface{}{
-			testData["store"]["books"],
 			testData["store"]["bicycles"],
+			testData["store"]["books"],
 			testData["store"]["counts"],
 			testData["store"]["wombats"],
 		},
@@ -196,6 +302,7 @@ func Test_SampleRun(t *testing.T) {
 
 	context := obpath.NewContext()
 	context.AllowDescendants = true
+	context.SortKeys = true
 
 	// Add a pretty stupid custom condition
 	context.ConditionFunctions["nonfiction"] = &obpath.ConditionFunction{
@@ -244,3 +351,1157 @@ func Test_SampleRun(t *testing.T) {
 		}
 	}
 }
+
+func Test_Compare(t *testing.T) {
+	published := time.Date(1851, time.October, 18, 0, 0, 0, 0, time.UTC)
+	ordered := [][]interface{}{
+		{1, 2.5},
+		{float32(1.5), int64(2)},
+		{"Ahab", "Ishmael"},
+		{color("blue"), "red"},
+		{published, published.Add(time.Hour)},
+		{&published, "1851-10-18T02:00:00+01:00"},
+		{"1851-10-18T00:00:00Z", published.Add(time.Second)},
+		{"1851-10-18T00:00:00+01:00", "1851-10-17T23:30:00Z"},
+	}
+	for _, pair := range ordered {
+		order, error := obpath.Compare(pair[0], pair[1])
+		if error != nil || order >= 0 {
+			t.Errorf("Expected %#v to be less than %#v, got %v (%v)", pair[0], pair[1], order, error)
+		}
+		order, error = obpath.Compare(pair[1], pair[0])
+		if error != nil || order <= 0 {
+			t.Errorf("Expected %#v to be greater than %#v, got %v (%v)", pair[1], pair[0], order, error)
+		}
+	}
+
+	incomparable := [][]interface{}{
+		{"Ahab", 1},
+		{published, "yesterday"},
+		{published, 1},
+		{nil, 1},
+		{true, false},
+	}
+	for _, pair := range incomparable {
+		if _, error := obpath.Compare(pair[0], pair[1]); error == nil {
+			t.Errorf("Expected %#v and %#v to be incomparable", pair[0], pair[1])
+		}
+	}
+}
+
+func Test_Equals(t *testing.T) {
+	equal := [][]interface{}{
+		{float32(5.52), 5.52},
+		{int(3), int64(3)},
+		{uint8(3), 3.0},
+		{color("red"), "red"},
+		{nil, (*book)(nil)},
+		{map[string]interface{}{"a": 1}, stringMap{"a": 1.0}},
+		{[]interface{}{1.0, "a"}, []interface{}{int64(1), "a"}},
+		{book{Title: "Moby Dick"}, &book{Title: "Moby Dick"}},
+	}
+	unequal := [][]interface{}{
+		{int64(-1), uint64(1)},
+		{5.5, 5.52},
+		{"1", 1},
+		{nil, 0},
+		{[]interface{}{1, 2}, []interface{}{1}},
+		{map[string]interface{}{"a": 1}, map[string]interface{}{"b": 1}},
+		{map[string]interface{}{"a": nil}, map[string]interface{}{"b": 1}},
+		{book{Title: "Moby Dick"}, bike{}},
+	}
+
+	for _, pair := range equal {
+		if !obpath.Equals(pair[0], pair[1], 0) {
+			t.Errorf("Expected %#v to equal %#v", pair[0], pair[1])
+		}
+	}
+	for _, pair := range unequal {
+		if obpath.Equals(pair[0], pair[1], 0) {
+			t.Errorf("Expected %#v not to equal %#v", pair[0], pair[1])
+		}
+	}
+	if !obpath.Equals(8.99, 8.98, 0.011) {
+		t.Error("Expected numbers within the tolerance to be equal")
+	}
+
+	context := obpath.NewContext()
+	context.FloatTolerance = 0.02
+	matches := evaluateHelper(".books[*](eq(@.Price, 9)).Title", context, map[string]interface{}{
+		"books": []interface{}{
+			book{Title: "Sword of Honour", Price: 12.99},
+			book{Title: "Moby Dick", Price: 8.99},
+		},
+	})
+	if !reflect.DeepEqual(matches, []interface{}{"Moby Dick"}) {
+		t.Errorf("Expected eq to respect the float tolerance, got %v", matches)
+	}
+
+	scooters := []interface{}{scooter{Color: "red", Price: 99.5}, scooter{Color: "blue", Price: 120}}
+	matches = evaluateHelper("[*](eq(@.Color, 'red')).Price", context, scooters)
+	if !reflect.DeepEqual(matches, []interface{}{float32(99.5)}) {
+		t.Errorf("Expected named string types to equal string literals, got %v", matches)
+	}
+}
+
+func Test_CaseFolding(t *testing.T) {
+	data := map[string]interface{}{
+		"words": []interface{}{"ſtory", "ΟΔΟΣ", "Kelvin", "Straße"},
+	}
+	tests := map[string][]interface{}{
+		".words[*](ciStartsWith(@, 'STO'))":  {"ſtory"},
+		".words[*](ciEndsWith(@, 'οδος'))":   {"ΟΔΟΣ"},
+		".words[*](ciGlob(@, 'k*N'))":        {"Kelvin"},
+		".words[*](cicontains(@, 'STORY'))":  {"ſtory"},
+		".words[*](startsWith(@, 'st'))":     {},
+		".words[*](ciStartsWith(@, 'STRA'))": {"Straße"},
+	}
+
+	context := obpath.NewContext()
+	for path, expected := range tests {
+		matches := evaluateHelper(path, context, data)
+		if !reflect.DeepEqual(matches, expected) {
+			t.Errorf("Expected %v to match %v, got %v", path, expected, matches)
+		}
+	}
+}
+
+func evaluateHelper(path string, context *obpath.Context, data interface{}) []interface{} {
+	result := make(chan interface{})
+	go obpath.MustCompile(path, context).Evaluate(data, result)
+
+	matches := []interface{}{}
+	for item := range result {
+		matches = append(matches, item)
+	}
+	return matches
+}
+
+func Test_Register(t *testing.T) {
+	context := obpath.NewContext()
+	context.AllowDescendants = true
+
+	err := context.Register("cheaperThan", func(values []interface{}, max float64) bool {
+		for _, value := range values {
+			if price, ok := value.(float32); ok && float64(price) < max {
+				return true
+			}
+		}
+		return false
+	})
+	if err != nil {
+		t.Fatalf("Could not register cheaperThan: %v", err)
+	}
+
+	err = context.Register("writtenBy", func(values []interface{}, authors ...string) bool {
+		for _, value := range values {
+			for _, author := range authors {
+				if value == author {
+					return true
+				}
+			}
+		}
+		return false
+	})
+	if err != nil {
+		t.Fatalf("Could not register writtenBy: %v", err)
+	}
+
+	data := map[string]interface{}{
+		"books": []interface{}{
+			book{Author: "Evelyn Waugh", Title: "Sword of Honour", Price: 12.99},
+			book{Author: "Louis L'Amour", Title: "Westward the Tide", Price: 5.52},
+			book{Author: "Herman Melville", Title: "Moby Dick", Price: 8.99},
+		},
+	}
+	tests := map[string][]interface{}{
+		".books[*](cheaperThan(@.Price, 9)).Title":                              {"Westward the Tide", "Moby Dick"},
+		".books[*](writtenBy(@.Author, 'Herman Melville', 'Nigel Rees')).Title": {"Moby Dick"},
+		".books[*](writtenBy(@.Author)).Title":                                  {},
+	}
+	for path, expected := range tests {
+		matches := evaluateHelper(path, context, data)
+		if !reflect.DeepEqual(matches, expected) {
+			t.Errorf("Expected %v to match %v, got %v", path, expected, matches)
+		}
+	}
+
+	if _, err = obpath.Compile(".books[*](cheaperThan(@.Price, 'free'))", context); err == nil {
+		t.Error("Expected a syntax error when passing a string to a float parameter")
+	}
+
+	failures := map[string]interface{}{
+		"eq":          func(values []interface{}) bool { return false },
+		"all":         func(values []interface{}) bool { return false },
+		"bad name":    func(values []interface{}) bool { return false },
+		"":            func(values []interface{}) bool { return false },
+		"notAFunc":    "foo",
+		"noResult":    func(values []interface{}) {},
+		"noParams":    func() bool { return false },
+		"badParamMap": func(values map[string]interface{}) bool { return false },
+	}
+	for name, fn := range failures {
+		if err = context.Register(name, fn); err == nil {
+			t.Errorf("Expected registering %q to fail", name)
+		}
+	}
+
+	// Numbers that don't fit the parameter are syntax errors rather than truncated
+	context.Register("smallerThan", func(values []interface{}, max int8) bool { return true })
+	context.Register("atLeast", func(values []interface{}, min uint) bool { return true })
+	context.Register("tiny", func(values []interface{}, max float32) bool { return true })
+	for path, fails := range map[string]bool{
+		".books(smallerThan(@, 100))":                                 false,
+		".books(smallerThan(@, 300))":                                 true,
+		".books(atLeast(@, -1))":                                      true,
+		".books(tiny(@, 1.5))":                                        false,
+		".books(tiny(@, 1000000000000000000000000000000000000000.0))": true,
+	} {
+		_, err = obpath.Compile(path, context)
+		if _, ok := err.(*obpath.SyntaxError); ok != fails {
+			t.Errorf("Expected compiling %v to fail: %v, got %v", path, fails, err)
+		}
+	}
+}
+
+func Test_EvaluationErrors(t *testing.T) {
+	context := obpath.NewContext()
+	err := context.Register("validISBN", func(values []interface{}) (bool, error) {
+		for _, value := range values {
+			isbn, ok := value.(string)
+			if !ok {
+				return false, fmt.Errorf("ISBN %v is not a string", value)
+			}
+			if isbn != "" {
+				return true, nil
+			}
+		}
+		return false, nil
+	})
+	if err != nil {
+		t.Fatalf("Could not register validISBN: %v", err)
+	}
+	context.ConditionFunctions["explode"] = &obpath.ConditionFunction{
+		TestFunction: func(arguments []obpath.ExpressionArgument) bool {
+			return arguments[0].Value.([]interface{})[0].(string) != ""
+		},
+		Arguments: []int{obpath.PathArg},
+	}
+	context.ValueFunctions["strictLength"] = &obpath.ValueFunction{
+		FunctionWithError: func(arguments []obpath.ExpressionArgument) ([]interface{}, error) {
+			values := []interface{}{}
+			for _, value := range arguments[0].Value.([]interface{}) {
+				s, ok := value.(string)
+				if !ok {
+					return nil, fmt.Errorf("can't get the length of %v", value)
+				}
+				values = append(values, len(s))
+			}
+			return values, nil
+		},
+		Arguments: []int{obpath.PathArg},
+	}
+
+	data := stringMap{
+		"books": []interface{}{
+			book{ISBN: "0-553-24766-2"},
+			stringMap{"ISBN": 42},
+			book{ISBN: "0-395-19395-8"},
+		},
+	}
+
+	for _, pathExpression := range []string{
+		".books[*](validISBN(@.ISBN)).ISBN",
+		".books[*](explode(@.ISBN)).ISBN",
+		".books[*](gt(strictLength(@.ISBN), 0)).ISBN",
+	} {
+		path := obpath.MustCompile(pathExpression, context)
+
+		matches, err := path.Matches(data)
+		if !reflect.DeepEqual(matches, []interface{}{"0-553-24766-2"}) {
+			t.Errorf("Expected the matches before the error for %v, got %v", pathExpression, matches)
+		}
+
+		evalError, ok := err.(*obpath.EvaluationError)
+		if !ok {
+			t.Errorf("Expected an evaluation error for %v, got %#v", pathExpression, err)
+			continue
+		}
+		if evalError.Location != ".books[1]" || evalError.Step != 1 {
+			t.Errorf("Expected the error at step 1 of .books[1], got step %v of %v", evalError.Step, evalError.Location)
+		}
+
+		// Evaluate skips the items that fail
+		matches = evaluateHelper(pathExpression, context, data)
+		if !reflect.DeepEqual(matches, []interface{}{"0-553-24766-2", "0-395-19395-8"}) {
+			t.Errorf("Expected Evaluate to skip failing items for %v, got %v", pathExpression, matches)
+		}
+	}
+
+	matches, err := obpath.MustCompile(".books[*].ISBN", context).Matches(data)
+	if err != nil || len(matches) != 3 {
+		t.Errorf("Expected all ISBNs without errors, got %v (%v)", matches, err)
+	}
+}
+
+func Test_StrictMode(t *testing.T) {
+	data := stringMap{
+		"server": stringMap{
+			"host": "localhost",
+			"port": 8080,
+		},
+		"ports": []int{8080, 8081},
+		"names": []string{"web", "worker"},
+	}
+
+	failures := map[string]string{
+		".server.prot":           ".server",
+		".server.port.number":    ".server.port",
+		".server[0]":             ".server",
+		".ports[5]":              ".ports",
+		".ports[1:4]":            ".ports",
+		".ports[0].*":            ".ports[0]",
+		".names[*](gt(@, 10))":   ".names[0]",
+		".server.host(lt(@, 1))": ".server.host",
+	}
+	successes := map[string][]interface{}{
+		".server.port":                  {8080},
+		".ports[-1]":                    {8081},
+		".names[*]":                     {"web", "worker"},
+		".server(has(@.missing)).port":  {},
+		".server(!has(@.missing)).port": {8080},
+		"..port":                        {8080},
+	}
+
+	context := obpath.NewContext()
+	context.AllowDescendants = true
+
+	for pathExpression := range failures {
+		if _, err := obpath.MustCompile(pathExpression, context).Matches(data); err != nil {
+			t.Errorf("Expected %v not to fail when not strict, got %v", pathExpression, err)
+		}
+	}
+
+	context.Strict = true
+	for pathExpression, location := range failures {
+		_, err := obpath.MustCompile(pathExpression, context).Matches(data)
+		evalError, ok := err.(*obpath.EvaluationError)
+		if !ok {
+			t.Errorf("Expected an evaluation error for %v in strict mode, got %#v", pathExpression, err)
+		} else if evalError.Location != location {
+			t.Errorf("Expected the error for %v at %v, got %v", pathExpression, location, evalError.Location)
+		}
+	}
+	for pathExpression, expected := range successes {
+		matches, err := obpath.MustCompile(pathExpression, context).Matches(data)
+		if err != nil || !reflect.DeepEqual(matches, expected) {
+			t.Errorf("Expected %v to match %v in strict mode, got %v (%v)", pathExpression, expected, matches, err)
+		}
+	}
+}
+
+func Test_Explain(t *testing.T) {
+	data := stringMap{
+		"books": []interface{}{
+			book{Title: "Sword of Honour", Price: 12.99},
+			book{Title: "Westward the Tide", Price: 5.52},
+			stringMap{"Title": "Moby Dick"},
+		},
+	}
+
+	context := obpath.NewContext()
+	explanation := obpath.MustCompile(".books[*](gt(@.Price, 6)).Title", context).Explain(data)
+
+	if !reflect.DeepEqual(explanation.Matches, []interface{}{"Sword of Honour"}) {
+		t.Errorf("Expected the explanation to have the matches, got %v", explanation.Matches)
+	}
+	if len(explanation.Steps) != 3 {
+		t.Fatalf("Expected a report for each of the 3 steps, got %v", len(explanation.Steps))
+	}
+
+	counts := [][]int{}
+	for _, step := range explanation.Steps {
+		counts = append(counts, []int{step.Entered, step.Selected, step.Passed})
+	}
+	if !reflect.DeepEqual(counts, [][]int{{1, 1, 1}, {1, 3, 1}, {1, 1, 1}}) {
+		t.Errorf("Unexpected entered, selected and passed counts: %v", counts)
+	}
+
+	step := explanation.Steps[1]
+	if step.Step != "[*](gt(@.Price, 6))" {
+		t.Errorf("Expected the step source to be reported, got %q", step.Step)
+	}
+	if len(step.Dropped) != 2 {
+		t.Fatalf("Expected 2 dropped items, got %v", step.Dropped)
+	}
+	dropped := step.Dropped[0]
+	if dropped.Location != ".books[1]" || !reflect.DeepEqual(dropped.Arguments[0].Value, []interface{}{float32(5.52)}) {
+		t.Errorf("Expected .books[1] to be dropped with its price as argument, got %v: %v", dropped.Location, dropped.Arguments)
+	}
+	if dropped = step.Dropped[1]; dropped.Location != ".books[2]" || len(dropped.Arguments[0].Value.([]interface{})) != 0 {
+		t.Errorf("Expected .books[2] to be dropped without a price, got %v: %v", dropped.Location, dropped.Arguments)
+	}
+
+	report := explanation.String()
+	for _, line := range []string{
+		"Path \".books[*](gt(@.Price, 6)).Title\" matched 1 items\n",
+		"2. [*](gt(@.Price, 6)): entered 1, selected 3, passed 1\n",
+		"   dropped .books[1]: condition was false, arguments: [5.52], 6\n",
+	} {
+		if !strings.Contains(report, line) {
+			t.Errorf("Expected the report to contain %q, got:\n%v", line, report)
+		}
+	}
+}
+
+func Test_Limits(t *testing.T) {
+	data := stringMap{
+		"a": stringMap{
+			"b": stringMap{
+				"c": []interface{}{1, 2, 3, 4, 5},
+			},
+		},
+	}
+
+	compileFailures := map[string]obpath.Limits{
+		".a.b.c":                           {MaxPathLength: 5},
+		".a(gt(length(@.b), 1))":           {MaxNesting: 1},
+		".a(in(@.b, [[1, [2]]]))":          {MaxNesting: 3},
+		".a(has(@.b(has(@.c(gt(@, 1))))))": {MaxNesting: 2},
+	}
+	for pathExpression, limits := range compileFailures {
+		context := obpath.NewContext()
+		context.Limits = limits
+		_, err := obpath.Compile(pathExpression, context)
+		if _, ok := err.(*obpath.LimitError); !ok {
+			t.Errorf("Expected a limit error compiling %v, got %#v", pathExpression, err)
+		}
+	}
+
+	evaluationFailures := map[string]obpath.Limits{
+		".a.b.c[*]":             {MaxDepth: 3},
+		"..c":                   {MaxNodes: 5},
+		".a(has(@.b.c[*])).b":   {MaxNodes: 6},
+		".a.b.c[0:4]":           {MaxResults: 4},
+		".a.b.c[*](gt(@, 0))":   {MaxResults: 2},
+		"..*":                   {MaxDepth: 2},
+		".a(has(@.b.c[*])).b.c": {MaxDepth: 2},
+	}
+	for pathExpression, limits := range evaluationFailures {
+		context := obpath.NewContext()
+		context.AllowDescendants = true
+		context.Limits = limits
+
+		path := obpath.MustCompile(pathExpression, context)
+		_, err := path.Matches(data)
+		var limitError *obpath.LimitError
+		if !errors.As(err, &limitError) {
+			t.Errorf("Expected a limit error evaluating %v, got %#v", pathExpression, err)
+		}
+
+		// Evaluate stops without any further results
+		matches := evaluateHelper(pathExpression, context, data)
+		if limits.MaxResults > 0 && len(matches) != limits.MaxResults {
+			t.Errorf("Expected Evaluate to stop at %v results for %v, got %v", limits.MaxResults, pathExpression, matches)
+		}
+	}
+
+	context := obpath.NewContext()
+	context.Limits = obpath.Limits{
+		MaxPathLength: 20,
+		MaxNesting:    2,
+		MaxDepth:      4,
+		MaxNodes:      25,
+		MaxResults:    5,
+	}
+	matches, err := obpath.MustCompile(".a.b.c[*](gt(@, 0))", context).Matches(data)
+	if err != nil || len(matches) != 5 {
+		t.Errorf("Expected a query within the limits to succeed, got %v (%v)", matches, err)
+	}
+}
+
+func Test_CopiedContext(t *testing.T) {
+	full := obpath.NewContext()
+
+	tolerant := *full
+	tolerant.FloatTolerance = 0.5
+	matches, err := obpath.MustCompile(".a(eq(@, 1))", &tolerant).Matches(stringMap{"a": 1.2})
+	if err != nil || len(matches) != 1 {
+		t.Errorf("Expected the tolerance of the copied context to be used, got %v (%v)", matches, err)
+	}
+
+	strict := *full
+	strict.Strict = true
+	_, err = obpath.MustCompile(".names[*](gt(@, 10))", &strict).Matches(stringMap{"names": []string{"web"}})
+	if _, ok := err.(*obpath.EvaluationError); !ok {
+		t.Errorf("Expected an error comparing a string in the strict copy, got %v", err)
+	}
+
+	// The original context is left as it was
+	matches, err = obpath.MustCompile(".names[*](gt(@, 10))", full).Matches(stringMap{"names": []string{"web"}})
+	if err != nil || len(matches) != 0 {
+		t.Errorf("Expected no matches and no error with the original context, got %v (%v)", matches, err)
+	}
+}
+
+func Test_NilContext(t *testing.T) {
+	data := stringMap{"a": stringMap{"b": 1}}
+
+	matches, err := obpath.MustCompile(".a.b", nil).Matches(data)
+	if err != nil || !reflect.DeepEqual(matches, []interface{}{1}) {
+		t.Errorf("Expected a nil context to work like the default one, got %v (%v)", matches, err)
+	}
+
+	set, err := obpath.CompileSet([]string{".a", ".a.b"}, nil)
+	if err != nil {
+		t.Fatalf("Could not compile set with a nil context: %v", err)
+	}
+	if setMatches, err := set.Matches(data); err != nil || len(setMatches) != 2 {
+		t.Errorf("Expected both paths in the set to match, got %v (%v)", setMatches, err)
+	}
+}
+
+func Test_Capabilities(t *testing.T) {
+	denied := []struct {
+		path     string
+		features obpath.Feature
+		index    int
+	}{
+		{".store..books", obpath.Descendants, 6},
+		{".store.*", obpath.Wildcards, 7},
+		{".store.books[*]", obpath.Wildcards, 13},
+		{".store.books[1:2]", obpath.Slices, 13},
+		{".store.books[:2]", obpath.Slices, 13},
+		{".store.books[0](has(@.ISBN))", obpath.Conditions, 15},
+		{".store(gt(count(@.books[*]), 1))", obpath.ValueFunctions, 10},
+		{".store(all(gt(@.books[*].Price, 5)))", obpath.Quantifiers, 7},
+	}
+
+	for _, test := range denied {
+		context := obpath.NewContext()
+		context.AllowDescendants = true
+		_, err := obpath.Compile(test.path, context)
+		if err != nil {
+			t.Errorf("Expected %v to compile with all features, got %v", test.path, err)
+		}
+
+		context.Denied = test.features
+		_, err = obpath.Compile(test.path, context)
+		syntaxError, ok := err.(*obpath.SyntaxError)
+		if !ok {
+			t.Errorf("Expected a syntax error compiling %v without %v, got %#v", test.path, obpath.FeatureNames(test.features), err)
+		} else if syntaxError.Index != test.index {
+			t.Errorf("Expected the error for %v at character %v, got %v", test.path, test.index, err)
+		}
+	}
+
+	context := obpath.NewContext()
+	context.Denied = obpath.Wildcards | obpath.Slices
+	context.DeniedFunctions = map[string]bool{"contains": true, "keys": true}
+	allowed := []string{
+		".store.books[0].Title",
+		".store.books[-1](has(@.ISBN))",
+		".store(gt(count(@.books), 1))",
+	}
+	for _, path := range allowed {
+		if _, err := obpath.Compile(path, context); err != nil {
+			t.Errorf("Expected %v to compile with a locked down context, got %v", path, err)
+		}
+	}
+	for _, path := range []string{".store(contains(@.Name, 'a'))", ".store(has(keys(@)))"} {
+		if _, err := obpath.Compile(path, context); err == nil {
+			t.Errorf("Expected denied functions to be rejected in %v", path)
+		}
+	}
+}
+
+type comment struct {
+	Text    string
+	Parent  *comment
+	Replies []*comment
+}
+
+func Test_Cycles(t *testing.T) {
+	root := &comment{Text: "first"}
+	reply := &comment{Text: "second", Parent: root}
+	root.Replies = []*comment{reply, root}
+
+	loop := map[string]interface{}{"Name": "loop"}
+	loop["Self"] = loop
+
+	context := obpath.NewContext()
+	context.AllowDescendants = true
+
+	texts := evaluateHelper("..Text", context, root)
+	if !reflect.DeepEqual(texts, []interface{}{"first", "second"}) {
+		t.Errorf("Expected each comment text once, got %v", texts)
+	}
+
+	names := evaluateHelper("..Name", context, loop)
+	if !reflect.DeepEqual(names, []interface{}{"loop"}) {
+		t.Errorf("Expected the name of the looping map once, got %v", names)
+	}
+
+	// A cycle is found when the value was reached by a step before the
+	// descendant step
+	selfReply := &comment{Text: "self"}
+	selfReply.Replies = []*comment{selfReply}
+	texts = evaluateHelper(".a..Text", context, map[string]interface{}{"a": selfReply})
+	if !reflect.DeepEqual(texts, []interface{}{"self"}) {
+		t.Errorf("Expected the text of the comment replying to itself once, got %v", texts)
+	}
+	texts = evaluateHelper(".Replies[0]..Text", context, root)
+	if !reflect.DeepEqual(texts, []interface{}{"second"}) {
+		t.Errorf("Expected the parent of the reply to be left out, got %v", texts)
+	}
+
+	parent := evaluateHelper(".Replies[0].Parent.Text", context, root)
+	if !reflect.DeepEqual(parent, []interface{}{"first"}) {
+		t.Errorf("Expected pointers to be followed, got %v", parent)
+	}
+
+	context.ReportCycles = true
+	path, err := obpath.Compile("..Text", context)
+	if err != nil {
+		t.Fatalf("Failed to compile path: %v", err)
+	}
+	if _, err := path.Matches(root); err == nil {
+		t.Error("Expected the cycle to be reported")
+	}
+}
+
+func Test_SortKeys(t *testing.T) {
+	context := obpath.NewContext()
+	context.SortKeys = true
+
+	numbers := map[int]string{10: "ten", 9: "nine", 2: "two", -1: "minus one"}
+	words := map[string]int{"b": 2, "c": 3, "a": 1}
+	// Strings that look like times are still sorted as strings
+	times := map[string]int{"b": 3, "2021-01-01T00:00:00Z": 2, "2021-01-01T00:00:00+05:00": 1}
+	mixed := map[interface{}]string{"a": "string", 2.5: "float", 1: "int", true: "bool", nil: "null"}
+
+	for i := 0; i < 10; i++ {
+		if values := evaluateHelper(".*", context, numbers); !reflect.DeepEqual(values, []interface{}{"minus one", "two", "nine", "ten"}) {
+			t.Fatalf("Expected the values of numeric keys in order, got %v", values)
+		}
+		if values := evaluateHelper(".*", context, words); !reflect.DeepEqual(values, []interface{}{1, 2, 3}) {
+			t.Fatalf("Expected the values of string keys in order, got %v", values)
+		}
+		if values := evaluateHelper(".*", context, times); !reflect.DeepEqual(values, []interface{}{1, 2, 3}) {
+			t.Fatalf("Expected the values of time-like keys in string order, got %v", values)
+		}
+		if values := evaluateHelper(".*", context, mixed); !reflect.DeepEqual(values, []interface{}{"null", "bool", "int", "float", "string"}) {
+			t.Fatalf("Expected the values of mixed keys in kind order, got %v", values)
+		}
+	}
+}
+
+// readTestData decodes a JSON file in testdata
+func readTestData(t testing.TB, name string) interface{} {
+	file, err := os.Open("testdata/" + name)
+	if err != nil {
+		t.Fatalf("Could not open %v: %v", name, err)
+	}
+	defer file.Close()
+
+	var data interface{}
+	if err := json.NewDecoder(file).Decode(&data); err != nil {
+		t.Fatalf("Could not decode %v: %v", name, err)
+	}
+	return data
+}
+
+// withNamedTypes copies data decoded by encoding/json into named map and
+// slice types, which are evaluated using reflection
+func withNamedTypes(value interface{}) interface{} {
+	switch value := value.(type) {
+	case map[string]interface{}:
+		copied := stringMap{}
+		for key, item := range value {
+			copied[key] = withNamedTypes(item)
+		}
+		return copied
+	case []interface{}:
+		copied := make(itemList, len(value))
+		for i, item := range value {
+			copied[i] = withNamedTypes(item)
+		}
+		return copied
+	}
+	return value
+}
+
+func Test_GenericValues(t *testing.T) {
+	data := readTestData(t, "data.json")
+	named := withNamedTypes(data)
+
+	context := obpath.NewContext()
+	context.AllowDescendants = true
+	context.SortKeys = true
+
+	for _, query := range readTestData(t, "queries.json").([]interface{}) {
+		path := query.([]interface{})[1].(string)
+
+		generic, _ := json.Marshal(evaluateHelper(path, context, data))
+		reflected, _ := json.Marshal(evaluateHelper(path, context, named))
+		if string(generic) != string(reflected) {
+			t.Errorf("Expected the same results for %v with and without reflection, got %s and %s", path, generic, reflected)
+		}
+	}
+}
+
+var benchmarkPaths = []string{
+	".store.books[*].Title",
+	"..Price",
+	".store.books[*](gt(@.Price, 10)).Author",
+	".store.*[*](has(@.ISBN))",
+}
+
+func benchmarkEvaluate(b *testing.B, context *obpath.Context, expressions []string, data interface{}) {
+	paths := make([]*obpath.Path, len(expressions))
+	for i, path := range expressions {
+		paths[i] = obpath.MustCompile(path, context)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, path := range paths {
+			if _, err := path.Matches(data); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
+
+func Benchmark_GenericValues(b *testing.B) {
+	context := obpath.NewContext()
+	context.AllowDescendants = true
+	benchmarkEvaluate(b, context, benchmarkPaths, readTestData(b, "data.json"))
+}
+
+func Benchmark_ReflectedValues(b *testing.B) {
+	context := obpath.NewContext()
+	context.AllowDescendants = true
+	benchmarkEvaluate(b, context, benchmarkPaths, withNamedTypes(readTestData(b, "data.json")))
+}
+
+type audited struct {
+	CreatedBy string
+	UpdatedBy string `json:"updated_by"`
+}
+
+type post struct {
+	audited
+	*bike
+	Title  string `json:"title"`
+	Name   string `json:"Title"`
+	Ignore string `json:"-"`
+	draft  bool
+}
+
+func Test_StructFields(t *testing.T) {
+	context := obpath.NewContext()
+	data := post{
+		audited: audited{CreatedBy: "alice", UpdatedBy: "bob"},
+		Title:   "Hello",
+		Name:    "hello",
+		Ignore:  "ignored",
+		draft:   true,
+	}
+
+	tests := map[string][]interface{}{
+		".Title":      []interface{}{"Hello"},
+		".title":      []interface{}{},
+		".CreatedBy":  []interface{}{"alice"},
+		".UpdatedBy":  []interface{}{"bob"},
+		".updated_by": []interface{}{},
+		".Ignore":     []interface{}{"ignored"},
+		".-":          []interface{}{},
+		".draft":      []interface{}{},
+		".Color":      []interface{}{},
+		".*":          []interface{}{"Hello", "hello", "ignored"},
+	}
+
+	// Look up the same struct type from many goroutines
+	done := make(chan bool)
+	for i := 0; i < 8; i++ {
+		go func() {
+			for path, expected := range tests {
+				if values := evaluateHelper(path, context, data); !reflect.DeepEqual(values, expected) {
+					t.Errorf("Expected %v for %v, got %v", expected, path, values)
+				}
+			}
+			done <- true
+		}()
+	}
+	for i := 0; i < 8; i++ {
+		<-done
+	}
+
+	data.bike = &bike{Color: "red"}
+	if values := evaluateHelper(".Color", context, data); !reflect.DeepEqual(values, []interface{}{"red"}) {
+		t.Errorf("Expected the field of an embedded pointer, got %v", values)
+	}
+}
+
+var conditionPaths = []string{
+	".books[*](has(@.ISBN)).Title",
+	".books[*](gt(@.Price, 10)).Title",
+	".books[*](contains(@.Tags[*], 'classic'))",
+	".books[*](all(startsWith(@.Tags[*], 'c')))",
+}
+
+// benchmarkBooks makes a document with a thousand books
+func benchmarkBooks() interface{} {
+	books := make([]interface{}, 1000)
+	for i := range books {
+		books[i] = map[string]interface{}{
+			"Title":  fmt.Sprintf("Book %d", i),
+			"ISBN":   fmt.Sprintf("0-%d", i),
+			"Price":  float64(i % 20),
+			"Tags":   []interface{}{"classic", "fiction", "paperback"},
+			"Author": map[string]interface{}{"Name": "Anonymous", "Born": 1900 + i%100},
+		}
+	}
+	return map[string]interface{}{"books": books}
+}
+
+func Benchmark_Conditions(b *testing.B) {
+	context := obpath.NewContext()
+	benchmarkEvaluate(b, context, conditionPaths, benchmarkBooks())
+}
+
+func Test_HasShortCircuit(t *testing.T) {
+	books := make([]interface{}, 100)
+	for i := range books {
+		books[i] = map[string]interface{}{"Title": fmt.Sprint(i)}
+	}
+	data := map[string]interface{}{
+		"store": map[string]interface{}{"Name": "Books", "books": books},
+	}
+
+	// Visiting every book would exceed the limit
+	context := obpath.NewContext()
+	context.Limits = obpath.Limits{MaxNodes: 20}
+
+	path := obpath.MustCompile(".store(has(@.books[*].Title)).Name", context)
+	matches, err := path.Matches(data)
+	if err != nil {
+		t.Errorf("Expected has to stop at the first value, got %v", err)
+	} else if !reflect.DeepEqual(matches, []interface{}{"Books"}) {
+		t.Errorf("Expected the store name, got %v", matches)
+	}
+
+	path = obpath.MustCompile(".store(all(has(@.books[*].Title))).Name", context)
+	if _, err := path.Matches(data); err == nil {
+		t.Error("Expected all to go through every value")
+	}
+}
+
+func Test_PathSet(t *testing.T) {
+	data := readTestData(t, "data.json")
+
+	context := obpath.NewContext()
+	context.AllowDescendants = true
+	context.SortKeys = true
+
+	paths := []string{}
+	for _, query := range readTestData(t, "queries.json").([]interface{}) {
+		paths = append(paths, query.([]interface{})[1].(string))
+	}
+	// The same path twice gets matches for both
+	paths = append(paths, paths[len(paths)-1])
+
+	set := obpath.MustCompileSet(paths, context)
+	matches, err := set.Matches(data)
+	if err != nil {
+		t.Fatalf("Failed to evaluate path set: %v", err)
+	}
+
+	results := make([][]interface{}, len(paths))
+	for _, match := range matches {
+		results[match.Index] = append(results[match.Index], match.Value)
+	}
+	for index, path := range paths {
+		expected := evaluateHelper(path, context, data)
+		if len(expected) == 0 && len(results[index]) == 0 {
+			continue
+		}
+		if !reflect.DeepEqual(results[index], expected) {
+			t.Errorf("Expected %v from the set for %v, got %v", expected, path, results[index])
+		}
+	}
+
+	context.Strict = true
+	set = obpath.MustCompileSet([]string{".store.books[0].Title", ".store.bikes[0]"}, context)
+	matches, err = set.Matches(data)
+	evaluationError, ok := err.(*obpath.EvaluationError)
+	if !ok {
+		t.Errorf("Expected an evaluation error, got %v", err)
+	} else if evaluationError.Path != ".store.bikes[0]" || evaluationError.Step != 1 {
+		t.Errorf("Expected the error at the second step of .store.bikes[0], got %v", err)
+	} else if len(matches) != 1 {
+		t.Errorf("Expected the match before the error, got %v", matches)
+	}
+
+	if _, err := obpath.CompileSet([]string{".a", ".b("}, context); err == nil {
+		t.Error("Expected a syntax error compiling a set with an invalid path")
+	}
+
+	// Evaluation stops at the first match past the limit, like Path.Matches
+	calls := 0
+	context = obpath.NewContext()
+	context.Limits.MaxResults = 2
+	context.Register("counted", func(values []interface{}) bool {
+		calls++
+		return true
+	})
+	set = obpath.MustCompileSet([]string{".items[*](counted(@))"}, context)
+	matches, err = set.Matches(stringMap{"items": []int{1, 2, 3, 4, 5, 6}})
+	evaluationError, ok = err.(*obpath.EvaluationError)
+	if !ok {
+		t.Errorf("Expected a limit error, got %v", err)
+	} else if evaluationError.Location != ".items[2]" {
+		t.Errorf("Expected the error at .items[2], got %v", err)
+	} else if len(matches) != 2 || calls != 3 {
+		t.Errorf("Expected evaluation to stop after 2 matches, got %v after %v calls", matches, calls)
+	}
+}
+
+var extractionPaths = []string{
+	".books[*].Title",
+	".books[*].ISBN",
+	".books[*].Price",
+	".books[*].Tags[0]",
+	".books[*].Tags[-1]",
+	".books[*].Author.Name",
+	".books[*].Author.Born",
+	".books[0].Title",
+}
+
+func Benchmark_SeparatePaths(b *testing.B) {
+	context := obpath.NewContext()
+	benchmarkEvaluate(b, context, extractionPaths, benchmarkBooks())
+}
+
+func Benchmark_PathSet(b *testing.B) {
+	data := benchmarkBooks()
+	set := obpath.MustCompileSet(extractionPaths, obpath.NewContext())
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := set.Matches(data); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// readerHelper evaluates a path on JSON read from a string
+func readerHelper(path string, context *obpath.Context, data string) ([]interface{}, error) {
+	var err error
+	result := make(chan interface{})
+	go func() {
+		err = obpath.MustCompile(path, context).EvaluateReader(strings.NewReader(data), result)
+		close(result)
+	}()
+
+	matches := []interface{}{}
+	for item := range result {
+		matches = append(matches, item)
+	}
+	return matches, err
+}
+
+func Test_EvaluateReader(t *testing.T) {
+	file, err := os.ReadFile("testdata/data.json")
+	if err != nil {
+		t.Fatalf("Could not read test data: %v", err)
+	}
+	data := readTestData(t, "data.json")
+
+	context := obpath.NewContext()
+	context.AllowDescendants = true
+
+	// Streamed matches are in document order, compare them in any order
+	encodeSorted := func(values []interface{}) []string {
+		encoded := make([]string, len(values))
+		for i, value := range values {
+			bytes, _ := json.Marshal(value)
+			encoded[i] = string(bytes)
+		}
+		sort.Strings(encoded)
+		return encoded
+	}
+
+	for _, query := range readTestData(t, "queries.json").([]interface{}) {
+		path := query.([]interface{})[1].(string)
+
+		streamed, err := readerHelper(path, context, string(file))
+		if err != nil {
+			t.Errorf("Failed to evaluate %v on a stream: %v", path, err)
+		}
+		expected := evaluateHelper(path, context, data)
+		if !reflect.DeepEqual(encodeSorted(streamed), encodeSorted(expected)) {
+			t.Errorf("Expected %v for %v on a stream, got %v", expected, path, streamed)
+		}
+	}
+
+	stream := `{"items": [{"Title": "a", "Price": 5}, {"Title": "b", "Price": 15}]}
+{"items": [{"Title": "c", "Price": 25}, {"Price": 35}]}`
+	matches, err := readerHelper(".items[*](gt(@.Price, 10)).Title", context, stream)
+	if err != nil || !reflect.DeepEqual(matches, []interface{}{"b", "c"}) {
+		t.Errorf("Expected the titles of the expensive items in all documents, got %v, %v", matches, err)
+	}
+
+	matches, err = readerHelper(".items[*].Title", context, `{"items": [{"Title": "a"}, {"Title": `)
+	if err == nil {
+		t.Error("Expected an error for a truncated document")
+	} else if !reflect.DeepEqual(matches, []interface{}{"a"}) {
+		t.Errorf("Expected the matches before the error, got %v", matches)
+	}
+
+	// Indexes from the start are streamed, and past the end select the last item
+	for _, path := range []string{".items[1].Title", ".items[1:].Title", ".items[1:2].Title"} {
+		matches, err = readerHelper(path, context, `{"items": [{"Title": "a"}, {"Title": "b"}, {"Title": `)
+		if err == nil || !reflect.DeepEqual(matches, []interface{}{"b"}) {
+			t.Errorf("Expected the match for %v before the truncated item, got %v, %v", path, matches, err)
+		}
+	}
+	for _, path := range []string{
+		".items[0].Title",
+		".items[1].Title",
+		".items[5].Title",
+		".items[1:].Title",
+		".items[3:9].Title",
+		".items[3:1].Title",
+		".items[1:0].Title",
+		".items[5](gt(@.Price, 10)).Title",
+		".items[5]..Title",
+	} {
+		for _, document := range []string{`{"items": []}`, `{"items": [{"Title": "a", "Price": 5}]}`, stream} {
+			streamed, err := readerHelper(path, context, document)
+			if err != nil {
+				t.Errorf("Failed to evaluate %v on %v: %v", path, document, err)
+			}
+			expected := []interface{}{}
+			decoder := json.NewDecoder(strings.NewReader(document))
+			for decoder.More() {
+				var value interface{}
+				decoder.Decode(&value)
+				expected = append(expected, evaluateHelper(path, context, value)...)
+			}
+			if !reflect.DeepEqual(streamed, expected) {
+				t.Errorf("Expected %v for %v on %v, got %v", expected, path, document, streamed)
+			}
+		}
+	}
+
+	context.Strict = true
+	_, err = readerHelper(".items[*].Name", context, stream)
+	if _, ok := err.(*obpath.EvaluationError); !ok {
+		t.Errorf("Expected an evaluation error for a missing key in strict mode, got %v", err)
+	}
+	matches, err = readerHelper(".a.*", context, `{"a": {}}`)
+	if err != nil || len(matches) != 0 {
+		t.Errorf("Expected no matches and no error for the children of an empty object, got %v, %v", matches, err)
+	}
+}
+
+type event struct {
+	Type    string
+	Payload json.RawMessage
+	Extra   *json.RawMessage
+	Body    []byte
+}
+
+func Test_RawJSON(t *testing.T) {
+	extra := json.RawMessage(`{"Source": "api"}`)
+	events := []event{
+		{Type: "click", Payload: json.RawMessage(`{"Target": {"Id": 7}, "Tags": ["a", "b"]}`), Extra: &extra},
+		{Type: "view", Payload: json.RawMessage(`{"Target": {"Id": 12}}`), Body: []byte(`{"Id": 3}`)},
+		{Type: "broken", Payload: json.RawMessage(`{"Target": `)},
+		{Type: "empty"},
+	}
+
+	context := obpath.NewContext()
+	context.AllowDescendants = true
+
+	tests := map[string][]interface{}{
+		"[*].Payload.Target.Id":                 []interface{}{7.0, 12.0},
+		"[*](gt(@.Payload.Target.Id, 10)).Type": []interface{}{"view"},
+		"[*].Payload.Tags[-1]":                  []interface{}{"b"},
+		"[*].Extra.Source":                      []interface{}{"api"},
+		"[0]..Id":                               []interface{}{7.0},
+		"[1].Body.Id":                           []interface{}{},
+		"[0].Payload":                           []interface{}{events[0].Payload},
+		"[*](eq(@.Payload.Target.Id, 7)).Extra.Source": []interface{}{"api"},
+	}
+	for path, expected := range tests {
+		if values := evaluateHelper(path, context, events); !reflect.DeepEqual(values, expected) {
+			t.Errorf("Expected %v for %v, got %v", expected, path, values)
+		}
+	}
+
+	context.DecodeBytes = true
+	if values := evaluateHelper("[1].Body.Id", context, events); !reflect.DeepEqual(values, []interface{}{3.0}) {
+		t.Errorf("Expected byte slices to be decoded, got %v", values)
+	}
+
+	path := obpath.MustCompile("[*].Payload.Target.Id", context)
+	if _, err := path.Matches(events); err == nil {
+		t.Error("Expected an error decoding invalid JSON")
+	}
+}
+
+func Test_Concurrency(t *testing.T) {
+	data := benchmarkBooks()
+	paths := append(conditionPaths, extractionPaths...)
+
+	sequential := obpath.NewContext()
+	sequential.AllowDescendants = true
+	parallel := obpath.NewContext()
+	parallel.AllowDescendants = true
+	parallel.Concurrency = 4
+
+	for _, path := range append(paths, "..Name", ".books[10:20].Title", ".books[-3:].ISBN") {
+		expected := evaluateHelper(path, sequential, data)
+		if values := evaluateHelper(path, parallel, data); !reflect.DeepEqual(values, expected) {
+			t.Errorf("Expected the same matches for %v in parallel, got %v rather than %v", path, len(values), len(expected))
+		}
+	}
+
+	// The first failing item stops the evaluation, after the matches before it
+	err := parallel.Register("notTooLate", func(values []interface{}) (bool, error) {
+		for _, value := range values {
+			if value == "Book 500" {
+				return false, errors.New("too late")
+			}
+		}
+		return true, nil
+	})
+	if err != nil {
+		t.Fatalf("Failed to register condition: %v", err)
+	}
+	matches, err := obpath.MustCompile(".books[*](notTooLate(@.Title)).Title", parallel).Matches(data)
+	if err == nil {
+		t.Error("Expected an error from the condition")
+	} else if len(matches) != 500 || matches[499] != "Book 499" {
+		t.Errorf("Expected the 500 matches before the error, got %v", len(matches))
+	}
+
+	parallel.Limits = obpath.Limits{MaxResults: 100}
+	matches, err = obpath.MustCompile(".books[*].Title", parallel).Matches(data)
+	if _, ok := err.(*obpath.EvaluationError); !ok {
+		t.Errorf("Expected a limit error, got %v", err)
+	} else if len(matches) != 100 || matches[99] != "Book 99" {
+		t.Errorf("Expected the first 100 matches, got %v", len(matches))
+	}
+}
+
+func Benchmark_Concurrency(b *testing.B) {
+	context := obpath.NewContext()
+	context.Concurrency = 4
+	benchmarkEvaluate(b, context, conditionPaths, benchmarkBooks())
+}
@@ -0,0 +1,109 @@
+package obpath
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// itemResult is the outcome of evaluating one item in parallel
+type itemResult struct {
+	matches []itemMatch
+	error   *EvaluationError
+	done    chan bool
+}
+
+// itemMatch is a match and where it was found
+type itemMatch struct {
+	value interface{}
+	at    *location
+}
+
+// evaluateParallel evaluates an item step on the items from start to end
+// with a pool of workers. The matches of each item are held back until the
+// items before it are done, so they're emitted in order, and workers only run
+// a few items ahead of the oldest unfinished item.
+func (e *evaluation) evaluateParallel(index int, start int, end int, at *location, item func(int) interface{}) {
+	window := 2 * e.concurrency
+	queue := make(chan int, window)
+	results := make([]*itemResult, end-start+1)
+	var stopped int32
+	var workers sync.WaitGroup
+
+	for w := 0; w < e.concurrency; w++ {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			for i := range queue {
+				result := results[i-start]
+				if atomic.LoadInt32(&stopped) == 0 {
+					sub := e.fork(func(match interface{}, at *location) {
+						result.matches = append(result.matches, itemMatch{match, at})
+					})
+					sub.checkAndEvaluateNextStep(index, item(i), at.item(i))
+					result.error = sub.error
+				}
+				close(result.done)
+			}
+		}()
+	}
+
+	next := start
+	enqueue := func() {
+		results[next-start] = &itemResult{done: make(chan bool)}
+		queue <- next
+		next++
+	}
+	for next <= end && next-start < window {
+		enqueue()
+	}
+
+	for i := start; i <= end; i++ {
+		result := results[i-start]
+		<-result.done
+
+		// Matches are counted here, in order, so that a later item can't use
+		// up the result limit before an earlier one
+		for _, match := range result.matches {
+			e.result(match.value, match.at)
+			if e.done {
+				break
+			}
+		}
+		if result.error != nil && !e.done {
+			e.error = result.error
+			e.done = true
+		}
+		if e.done {
+			break
+		}
+
+		if next <= end {
+			enqueue()
+		}
+	}
+
+	atomic.StoreInt32(&stopped, 1)
+	close(queue)
+	workers.Wait()
+}
+
+// fork makes an evaluation for an item evaluated in parallel, which shares the
+// budget but has its own matches and error. Items within the item are
+// evaluated one by one.
+func (e *evaluation) fork(emit func(match interface{}, at *location)) *evaluation {
+	sub := &evaluation{
+		path:         e.path,
+		emit:         emit,
+		stopOnError:  e.stopOnError,
+		strict:       e.strict,
+		limits:       e.limits,
+		budget:       e.budget,
+		root:         e.root,
+		reportCycles: e.reportCycles,
+		sortKeys:     e.sortKeys,
+		decodeBytes:  e.decodeBytes,
+	}
+	// Matches are counted when they're emitted in order
+	sub.limits.MaxResults = 0
+	return sub
+}
@@ -0,0 +1,223 @@
+package obpath
+
+import (
+	"reflect"
+)
+
+// PathSet is a set of paths that are evaluated together. Steps that paths
+// start with in common are only evaluated once, so the object is walked once
+// rather than once per path.
+type PathSet struct {
+	context *Context
+	paths   []*Path
+	root    *setNode
+	// nodes is the number of nodes in the trie
+	nodes int
+}
+
+// SetMatch is a match of one of the paths in a PathSet
+type SetMatch struct {
+	// Index is the index of the matching path in the set
+	Index int
+	// Value is the matched value
+	Value interface{}
+}
+
+// setNode is a step shared by the paths in a set that start the same way
+type setNode struct {
+	// step is a path with only the step of the node
+	step *Path
+	// path is the first path in the set that goes through the node
+	path     *Path
+	id       int
+	depth    int
+	children []*setNode
+	// ends are the indexes of the paths that end at the node
+	ends []int
+}
+
+// MustCompileSet returns the compiled path set, and panics if there are any
+// errors.
+func MustCompileSet(paths []string, context *Context) *PathSet {
+	set, err := CompileSet(paths, context)
+	if err != nil {
+		panic(err)
+	}
+	return set
+}
+
+// CompileSet compiles paths into a set that can be evaluated in one pass.
+// A nil context is the same as NewContext().
+func CompileSet(paths []string, context *Context) (*PathSet, error) {
+	if context == nil {
+		context = NewContext()
+	}
+	set := &PathSet{
+		context: context,
+		paths:   make([]*Path, len(paths)),
+		root:    &setNode{},
+	}
+
+	for index, path := range paths {
+		compiled, err := Compile(path, context)
+		if err != nil {
+			return nil, err
+		}
+		set.paths[index] = compiled
+		set.add(index, compiled)
+	}
+	return set, nil
+}
+
+// add adds a path to the trie of steps, sharing the nodes of steps written
+// the same way
+func (set *PathSet) add(index int, path *Path) {
+	node := set.root
+	for depth, step := range path.steps {
+		var next *setNode
+		for _, child := range node.children {
+			if child.step.path == step.source {
+				next = child
+				break
+			}
+		}
+
+		if next == nil {
+			next = &setNode{
+				step: &Path{
+					context: set.context,
+					path:    step.source,
+					steps:   []pathStep{step},
+				},
+				path:  path,
+				id:    set.nodes,
+				depth: depth,
+			}
+			set.nodes++
+			node.children = append(node.children, next)
+		}
+		node = next
+	}
+	node.ends = append(node.ends, index)
+}
+
+// Evaluate finds everything matching the paths in the set, like
+// Path.Evaluate, and closes the result channel.
+func (set *PathSet) Evaluate(object interface{}, result chan<- SetMatch) {
+	s := set.newEvaluation(object, func(match SetMatch) {
+		result <- match
+	})
+	s.evaluateNode(set.root, object, nil)
+	close(result)
+}
+
+// Matches finds everything matching the paths in the set. Evaluation stops
+// at the first error, like Path.Matches.
+func (set *PathSet) Matches(object interface{}) ([]SetMatch, error) {
+	matches := []SetMatch{}
+	s := set.newEvaluation(object, func(match SetMatch) {
+		matches = append(matches, match)
+	})
+	s.stopOnError = true
+	s.evaluateNode(set.root, object, nil)
+
+	if s.error != nil {
+		return matches, s.error
+	}
+	return matches, nil
+}
+
+// setEvaluation is the state of a single evaluation of a path set
+type setEvaluation struct {
+	set         *PathSet
+	emit        func(match SetMatch)
+	stopOnError bool
+	error       *EvaluationError
+	budget      *budget
+	root        reference
+	// evaluations are the evaluations of the steps of the nodes, by node id
+	evaluations []*evaluation
+}
+
+func (set *PathSet) newEvaluation(object interface{}, emit func(match SetMatch)) *setEvaluation {
+	return &setEvaluation{
+		set:    set,
+		emit:   emit,
+		budget: &budget{},
+		root:   referenceTo(reflect.ValueOf(object)),
+
+		evaluations: make([]*evaluation, set.nodes),
+	}
+}
+
+// stepEvaluation gets the evaluation of the step of a node, which passes the
+// items it selects on to the children of the node. A node is never reached
+// again while its step is being evaluated, so the evaluation is reused.
+func (s *setEvaluation) stepEvaluation(node *setNode) *evaluation {
+	if e := s.evaluations[node.id]; e != nil {
+		return e
+	}
+
+	e := node.step.newEvaluation(func(match interface{}, at *location) {
+		s.evaluateNode(node, match, at)
+	})
+	e.stopOnError = s.stopOnError
+	e.budget = s.budget
+	e.root = s.root
+	// Matches of steps aren't results of the set
+	e.limits.MaxResults = 0
+
+	s.evaluations[node.id] = e
+	return e
+}
+
+// evaluateNode emits the object for the paths ending at a node, and
+// evaluates the steps of its children on it
+func (s *setEvaluation) evaluateNode(node *setNode, object interface{}, at *location) {
+	limits := s.set.context.Limits
+	for _, index := range node.ends {
+		if exceeded(s.budget.match(), limits.MaxResults) {
+			if s.error == nil {
+				path := s.set.paths[index]
+				s.error = &EvaluationError{
+					Path:     path.path,
+					Step:     len(path.steps),
+					Location: at.String(),
+					Err:      &LimitError{"MaxResults", limits.MaxResults},
+				}
+			}
+			s.stop()
+			return
+		}
+
+		s.emit(SetMatch{
+			Index: index,
+			Value: object,
+		})
+	}
+
+	for _, child := range node.children {
+		if s.error != nil {
+			return
+		}
+
+		e := s.stepEvaluation(child)
+		e.evaluateStep(0, object, at)
+
+		if e.error != nil && s.error == nil {
+			s.error = e.error
+			s.error.Path = child.path.path
+			s.error.Step = child.depth
+			s.stop()
+		}
+	}
+}
+
+// stop stops the evaluations of all steps after an error
+func (s *setEvaluation) stop() {
+	for _, e := range s.evaluations {
+		if e != nil {
+			e.done = true
+		}
+	}
+}
@@ -0,0 +1,169 @@
+package obpath
+
+import (
+	"fmt"
+	"reflect"
+)
+
+var (
+	valuesType = reflect.TypeOf([]interface{}{})
+	errorType  = reflect.TypeOf((*error)(nil)).Elem()
+)
+
+// Register adds a condition that calls an ordinary Go function. The function
+// must return a bool, or a bool and an error, and the argument types are derived from its parameters:
+// []interface{} accepts paths and array literals, strings, bools, integers and
+// floats accept the matching literals and interface{} accepts any literal. A
+// variadic function gets a variadic condition. An error is returned if the
+// name is taken or isn't a valid name, or if the function can't be used as a
+// condition.
+func (context *Context) Register(name string, fn interface{}) error {
+	if !isValidName(name) {
+		return fmt.Errorf("invalid condition name %q", name)
+	}
+	if _, reserved := quantifiers[name]; reserved {
+		return fmt.Errorf("condition name %q is reserved for a quantifier", name)
+	}
+	if _, exists := context.ConditionFunctions[name]; exists {
+		return fmt.Errorf("condition %q is already registered", name)
+	}
+
+	function, error := conditionFromFunc(fn)
+	if error != nil {
+		return fmt.Errorf("can't register condition %q: %v", name, error)
+	}
+
+	if context.ConditionFunctions == nil {
+		context.ConditionFunctions = map[string]*ConditionFunction{}
+	}
+	context.ConditionFunctions[name] = function
+	return nil
+}
+
+// conditionFromFunc wraps a function in a ConditionFunction
+func conditionFromFunc(fn interface{}) (*ConditionFunction, error) {
+	v := reflect.ValueOf(fn)
+	if fn == nil || v.Kind() != reflect.Func {
+		return nil, fmt.Errorf("expected a function, got %T", fn)
+	}
+
+	t := v.Type()
+	returnsError := t.NumOut() == 2 && t.Out(1) == errorType
+	if t.NumOut() == 0 || t.Out(0).Kind() != reflect.Bool || t.NumOut() > 1 && !returnsError {
+		return nil, fmt.Errorf("expected a function returning a bool or a bool and an error, got %v", t)
+	}
+	if t.NumIn() == 0 {
+		return nil, fmt.Errorf("expected a function with at least one parameter, got %v", t)
+	}
+
+	paramTypes := make([]reflect.Type, t.NumIn())
+	argTypes := make([]int, t.NumIn())
+	for i := range paramTypes {
+		paramTypes[i] = t.In(i)
+		if t.IsVariadic() && i == t.NumIn()-1 {
+			paramTypes[i] = paramTypes[i].Elem()
+		}
+
+		argType, error := argumentTypeOf(paramTypes[i])
+		if error != nil {
+			return nil, fmt.Errorf("parameter %v: %v", i+1, error)
+		}
+		argTypes[i] = argType
+	}
+
+	paramType := func(i int) reflect.Type {
+		if i < len(paramTypes) {
+			return paramTypes[i]
+		}
+		return paramTypes[len(paramTypes)-1]
+	}
+
+	return &ConditionFunction{
+		TestFunctionWithError: func(arguments []ExpressionArgument) (bool, error) {
+			in := make([]reflect.Value, len(arguments))
+			for i, argument := range arguments {
+				value, error := argumentValue(argument.Value, paramType(i))
+				if error != nil {
+					return false, fmt.Errorf("argument %v: %v", i+1, error)
+				}
+				in[i] = value
+			}
+
+			out := v.Call(in)
+			if returnsError && !out[1].IsNil() {
+				return false, out[1].Interface().(error)
+			}
+			return out[0].Bool(), nil
+		},
+		Arguments: argTypes,
+		Variadic:  t.IsVariadic(),
+		// Literals that don't fit their parameters are caught when compiling
+		check: func(arguments []ExpressionArgument) error {
+			for i, argument := range arguments {
+				if argument.Type == PathArg {
+					continue
+				}
+				if _, error := argumentValue(argument.Value, paramType(i)); error != nil {
+					return fmt.Errorf("argument %v: %v", i+1, error)
+				}
+			}
+			return nil
+		},
+	}, nil
+}
+
+// argumentTypeOf gets the argument type flags accepted by a parameter type
+func argumentTypeOf(t reflect.Type) (int, error) {
+	if t == valuesType {
+		return PathArg | ArrayArg, nil
+	}
+
+	switch k := t.Kind(); {
+	case k == reflect.Interface && t.NumMethod() == 0:
+		return LiteralArg, nil
+	case k == reflect.String:
+		return StringArg, nil
+	case k == reflect.Bool:
+		return BoolArg, nil
+	case isIntegerKind(k):
+		return IntegerArg, nil
+	case k == reflect.Float32 || k == reflect.Float64:
+		return FloatArg, nil
+	}
+	return 0, fmt.Errorf("unsupported parameter type %v", t)
+}
+
+// argumentValue converts an argument value to the type of a parameter. An
+// error is returned for numbers that the parameter type can't hold, rather
+// than truncating them.
+func argumentValue(value interface{}, t reflect.Type) (reflect.Value, error) {
+	if value == nil {
+		return reflect.Zero(t), nil
+	}
+
+	v := reflect.ValueOf(value)
+	converted := v.Convert(t)
+	switch {
+	case !isNumberKind(v.Kind()):
+	case isIntegerKind(t.Kind()) && isIntegerKind(v.Kind()):
+		if !integersEqual(v, converted) {
+			return converted, fmt.Errorf("%v overflows %v", value, t)
+		}
+	case isIntegerKind(t.Kind()):
+		if floatValue(converted) != v.Float() {
+			return converted, fmt.Errorf("%v isn't a whole number that fits in %v", value, t)
+		}
+	case t.Kind() == reflect.Float32 && converted.OverflowFloat(floatValue(v)):
+		return converted, fmt.Errorf("%v overflows %v", value, t)
+	}
+	return converted, nil
+}
+
+// isValidName checks if a name can be used in a path expression
+func isValidName(name string) bool {
+	if name == "" || name == "*" {
+		return false
+	}
+	c := compiler{path: name}
+	return c.skipName() && c.index == len(name)
+}
@@ -0,0 +1,280 @@
+package obpath
+
+import (
+	"encoding/json"
+	"io"
+	"reflect"
+)
+
+// EvaluateReader finds everything matching the path in the JSON documents
+// read from reader, without decoding more of the documents than it needs to.
+// Objects and arrays are stepped through token by token, and only matches and
+// the items that conditions are tested on are decoded. Matches are sent to the
+// result channel in the order they appear in the documents, whether or not
+// the context sorts keys. The channel isn't
+// closed, so that the error can be read safely after closing it:
+//
+//	go func() {
+//		err = path.EvaluateReader(reader, result)
+//		close(result)
+//	}()
+//
+// Like Matches, evaluation stops at the first error, which is returned as an
+// *EvaluationError. JSON syntax errors are returned as they are.
+func (path *Path) EvaluateReader(reader io.Reader, result chan<- interface{}) error {
+	decoder := json.NewDecoder(reader)
+
+	for {
+		// More is false at the end of the input, and before a stray delimiter
+		if !decoder.More() {
+			if _, err := decoder.Token(); err != io.EOF {
+				return err
+			}
+			return nil
+		}
+
+		s := &stream{
+			evaluation: path.newEvaluation(func(match interface{}, at *location) {
+				result <- match
+			}),
+			decoder: decoder,
+		}
+		s.stopOnError = true
+
+		err := s.value([]int{0}, nil, nil)
+		if err == io.EOF {
+			// The document was cut off
+			return io.ErrUnexpectedEOF
+		} else if err != nil {
+			return err
+		} else if s.error != nil {
+			return s.error
+		}
+	}
+}
+
+// stream is the state of the evaluation of a path on a document that's read
+// token by token
+type stream struct {
+	*evaluation
+	decoder *json.Decoder
+}
+
+// value evaluates the next value in the stream. The steps in states are
+// applied to the value, and the conditions of the steps in checks are tested
+// on it before going on to the next step.
+func (s *stream) value(states []int, checks []int, at *location) error {
+	if s.done || len(states) == 0 && len(checks) == 0 {
+		return s.skip()
+	}
+
+	if s.needsValue(states, checks) {
+		var value interface{}
+		if err := s.decoder.Decode(&value); err != nil {
+			return err
+		}
+		s.decoded(states, checks, value, at)
+		return nil
+	}
+
+	token, err := s.decoder.Token()
+	if err != nil {
+		return err
+	}
+
+	switch token {
+	case json.Delim('{'):
+		return s.object(states, at)
+	case json.Delim('['):
+		return s.array(states, at)
+	}
+
+	for _, index := range states {
+		s.evaluateStep(index, token, at)
+	}
+	return nil
+}
+
+// decoded evaluates the steps in states and checks on a decoded value
+func (s *stream) decoded(states []int, checks []int, value interface{}, at *location) {
+	for _, index := range checks {
+		s.checkAndEvaluateNextStep(index, value, at)
+	}
+	for _, index := range states {
+		s.evaluateStep(index, value, at)
+	}
+}
+
+// needsValue checks if the next value has to be decoded: when it's a match,
+// when conditions are tested on it, or when it has to be indexed by a step
+// that needs the length of the array.
+func (s *stream) needsValue(states []int, checks []int) bool {
+	if len(checks) > 0 {
+		return true
+	}
+
+	for _, index := range states {
+		if index >= len(s.path.steps) {
+			return true
+		}
+
+		// Indexes from the end and range checks need the length
+		step := s.path.steps[index]
+		if step.target == "item" && (step.start < 0 || step.end < -1 || s.strict && !(step.start == 0 && step.end == -1)) {
+			return true
+		}
+	}
+	return false
+}
+
+// enter checks the limits before stepping into an object or array
+func (s *stream) enter(states []int, at *location) bool {
+	if exceeded(s.budget.visit(), s.limits.MaxNodes) {
+		s.fail(states[0], at, &LimitError{"MaxNodes", s.limits.MaxNodes})
+		return false
+	}
+	if exceeded(at.getDepth(), s.limits.MaxDepth) {
+		s.fail(states[0], at, &LimitError{"MaxDepth", s.limits.MaxDepth})
+		return false
+	}
+	return true
+}
+
+// object evaluates the steps in states on an object, after its opening brace
+func (s *stream) object(states []int, at *location) error {
+	if !s.enter(states, at) {
+		return nil
+	}
+
+	found := make([]bool, len(states))
+	for s.decoder.More() {
+		token, err := s.decoder.Token()
+		if err != nil {
+			return err
+		}
+		key := token.(string)
+
+		var children, checks []int
+		for n, index := range states {
+			step := s.path.steps[index]
+			if step.target == "item" {
+				continue
+			}
+
+			if step.name == "*" || step.name == key {
+				found[n] = true
+				children, checks = s.selected(index, children, checks)
+			}
+			if step.target == "descendant" {
+				children = append(children, index)
+			}
+		}
+
+		if err := s.value(children, checks, at.child(key)); err != nil || s.done {
+			return err
+		}
+	}
+	if _, err := s.decoder.Token(); err != nil {
+		return err
+	}
+
+	for n, index := range states {
+		step := s.path.steps[index]
+		if step.target == "item" {
+			s.mismatch(index, at, "can't index a %v", reflect.Map)
+		} else if !found[n] && step.name != "*" {
+			s.mismatch(index, at, "missing key %q", step.name)
+		}
+	}
+	return nil
+}
+
+// array evaluates the steps in states on an array, after its opening bracket.
+// An index past the end selects the last item, so the items before the start
+// of an index are decoded and the last one is kept until the end is reached.
+func (s *stream) array(states []int, at *location) error {
+	if !s.enter(states, at) {
+		return nil
+	}
+
+	var last interface{}
+	length := 0
+	for ; s.decoder.More(); length++ {
+		var children, checks []int
+		keep := false
+		for _, index := range states {
+			step := s.path.steps[index]
+			if step.target == "item" {
+				if length >= step.start && (step.end == -1 || length <= step.end) {
+					children, checks = s.selected(index, children, checks)
+				} else if length < step.start {
+					keep = true
+				}
+			} else if step.name == "*" {
+				children, checks = s.selected(index, children, checks)
+			}
+			if step.target == "descendant" {
+				children = append(children, index)
+			}
+		}
+
+		if keep {
+			last = nil
+			if err := s.decoder.Decode(&last); err != nil {
+				return err
+			}
+			s.decoded(children, checks, last, at.item(length))
+		} else if err := s.value(children, checks, at.item(length)); err != nil {
+			return err
+		}
+		if s.done {
+			return nil
+		}
+	}
+	if _, err := s.decoder.Token(); err != nil {
+		return err
+	}
+
+	for _, index := range states {
+		step := s.path.steps[index]
+		if step.target == "item" {
+			if length > 0 && length <= step.start && (step.end == -1 || step.end >= length-1) {
+				children, checks := s.selected(index, nil, nil)
+				s.decoded(children, checks, last, at.item(length-1))
+			}
+		} else if step.name != "*" {
+			s.mismatch(index, at, "can't get %q from a %v", step.name, reflect.Slice)
+		}
+	}
+	return nil
+}
+
+// selected adds a value selected by a step to the next step, or to the checks
+// if the step has a condition
+func (s *stream) selected(index int, children []int, checks []int) ([]int, []int) {
+	if s.path.steps[index].condition != nil {
+		return children, append(checks, index)
+	}
+	return append(children, index+1), checks
+}
+
+// skip reads past the next value in the stream
+func (s *stream) skip() error {
+	depth := 0
+	for {
+		token, err := s.decoder.Token()
+		if err != nil {
+			return err
+		}
+
+		switch token {
+		case json.Delim('{'), json.Delim('['):
+			depth++
+		case json.Delim('}'), json.Delim(']'):
+			depth--
+		}
+		if depth == 0 {
+			return nil
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package obpath
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"unicode/utf8"
+)
+
+// ValueFunction is a function that computes values from its arguments, value
+// functions can be used wherever a path argument is accepted.
+type ValueFunction struct {
+	// Function is the function that will be run to compute the values.
+	Function func(arguments []ExpressionArgument) []interface{}
+	// FunctionWithError is used instead of Function when set, and can report
+	// an error instead of values.
+	FunctionWithError func(arguments []ExpressionArgument) ([]interface{}, error)
+	// Arguments are the accepted argument types
+	Arguments []int
+	// Defaults are the values of optional trailing arguments, the last default
+	// belongs to the last argument that isn't variadic
+	Defaults []ExpressionArgument
+	// Variadic allows the last argument type to be repeated any number of times
+	Variadic bool
+}
+
+// call runs the function, a panic in the function is returned as an error.
+func (function *ValueFunction) call(arguments []ExpressionArgument) (values []interface{}, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("value function panicked: %v", r)
+		}
+	}()
+
+	if function.FunctionWithError != nil {
+		return function.FunctionWithError(arguments)
+	}
+	return function.Function(arguments), nil
+}
+
+func (function *ValueFunction) signature() signature {
+	return signature{function.Arguments, function.Defaults, function.Variadic}
+}
+
+// valueCall is a compiled call to a value function
+type valueCall struct {
+	Function  *ValueFunction
+	Arguments []ExpressionArgument
+}
+
+// valueLength gets the length of strings, arrays, slices and maps. The length
+// of a string is the number of runes in it.
+func valueLength(arguments []ExpressionArgument) []interface{} {
+	matches := arguments[0].Value.([]interface{})
+	values := []interface{}{}
+
+	for _, match := range matches {
+		if match == nil {
+			continue
+		}
+
+		v := reflect.ValueOf(match)
+		switch v.Kind() {
+		case reflect.String:
+			values = append(values, utf8.RuneCountInString(v.String()))
+		case reflect.Array, reflect.Slice, reflect.Map:
+			values = append(values, v.Len())
+		}
+	}
+	return values
+}
+
+// valueLower converts strings to lower case
+func valueLower(arguments []ExpressionArgument) []interface{} {
+	matches := arguments[0].Value.([]interface{})
+	values := []interface{}{}
+
+	for _, match := range matches {
+		if match == nil {
+			continue
+		}
+
+		v := reflect.ValueOf(match)
+		if v.Kind() == reflect.String {
+			values = append(values, strings.ToLower(v.String()))
+		}
+	}
+	return values
+}
+
+// valueCount counts the number of matches
+func valueCount(arguments []ExpressionArgument) []interface{} {
+	matches := arguments[0].Value.([]interface{})
+	return []interface{}{len(matches)}
+}
+
+// valueKeys gets the keys of maps and the field names of structs. Map keys are
+// sorted so that the result is stable.
+func valueKeys(arguments []ExpressionArgument) []interface{} {
+	matches := arguments[0].Value.([]interface{})
+	values := []interface{}{}
+
+	for _, match := range matches {
+		if match == nil {
+			continue
+		}
+
+		v := reflect.ValueOf(match)
+		switch v.Kind() {
+		case reflect.Map:
+			keys := v.MapKeys()
+			sortValues(keys)
+			for _, key := range keys {
+				values = append(values, key.Interface())
+			}
+		case reflect.Struct:
+			for _, field := range fieldsOf(v.Type()).fields {
+				// Skip unexported fields
+				if field.exported {
+					values = append(values, field.name)
+				}
+			}
+		}
+	}
+	return values
+}
+
+// valueType gets the type names of the matches, see TypeName
+func valueType(arguments []ExpressionArgument) []interface{} {
+	matches := arguments[0].Value.([]interface{})
+	values := make([]interface{}, len(matches))
+
+	for i, match := range matches {
+		values[i] = TypeName(match)
+	}
+	return values
+}